@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/audit"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func auditVerifyCommand() *command {
+	return &command{
+		name:        "verify",
+		usage:       "verify [--config path] [--signer address] [file]",
+		description: "Check the hash chain and signatures of an audit log",
+		run: func(args []string) error {
+			fs := newFlagSet("audit verify")
+			configPath := fs.String("config", defaultConfigPath, "path to the operator config file, read when no file is given")
+			signer := fs.String("signer", "", "require every entry to be signed by this EVM address")
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+			if fs.NArg() > 1 {
+				return fmt.Errorf("expected at most one audit log file")
+			}
+			var want common.Address
+			if *signer != "" {
+				if !common.IsHexAddress(*signer) {
+					return fmt.Errorf("invalid signer address %q", *signer)
+				}
+				want = common.HexToAddress(*signer)
+			}
+
+			path := fs.Arg(0)
+			if path == "" {
+				cfg, err := config.LoadConfig(*configPath)
+				if err != nil {
+					return err
+				}
+				if cfg.Audit.Path == "" {
+					return fmt.Errorf("no audit log file given and audit.path is not set")
+				}
+				path = cfg.Audit.Path
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			report, verr := audit.Verify(f, want)
+			if err := printJSON(report); err != nil {
+				return err
+			}
+			return verr
+		},
+	}
+}
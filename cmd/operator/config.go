@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aura-nw/lotus-operator/config"
+)
+
+func configValidateCommand() *command {
+	return &command{
+		name:        "validate",
+		usage:       "validate [--config path]",
+		description: "Validate the config file",
+		run: func(args []string) error {
+			fs := newFlagSet("config validate")
+			configPath := fs.String("config", defaultConfigPath, "path to the operator config file")
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+
+			if _, err := config.LoadConfig(*configPath); err != nil {
+				return err
+			}
+			fmt.Printf("%s: config ok\n", *configPath)
+			return nil
+		},
+	}
+}
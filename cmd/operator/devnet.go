@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/internal/devnet"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const devnetRecipient = "0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A"
+
+func devnetCommand() *command {
+	return &command{
+		name:        "devnet",
+		usage:       "devnet [flags]",
+		description: "Run N operators against local chains and drive bridge flows",
+		run:         runDevnet,
+	}
+}
+
+// devnetFlow is the outcome of one deposit or withdrawal driven on the devnet.
+type devnetFlow struct {
+	Direction  string `json:"direction"`
+	Id         uint64 `json:"id"`
+	Status     uint8  `json:"status"`
+	Signatures int    `json:"valid_signatures,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runDevnet(args []string) error {
+	fs := newFlagSet("devnet")
+	operators := fs.Int("operators", 3, "number of operators")
+	threshold := fs.Int("threshold", 0, "votes and signatures required, a majority by default")
+	deposits := fs.Int("deposits", 1, "number of deposits to drive")
+	withdrawals := fs.Int("withdrawals", 1, "number of withdrawals to drive, each spending a deposit")
+	amount := fs.Int64("amount", 100000, "amount of each deposit in satoshi, withdrawals take half")
+	withdrawTo := fs.String("withdraw-to", "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", "regtest address withdrawals pay")
+	httpPort := fs.Int("http-port", 0, "port of the first operator server, random ports when 0")
+	timeout := fs.Duration("timeout", time.Minute, "how long to wait for each flow to reach the threshold")
+	keep := fs.Bool("keep", false, "keep the devnet running after the flows until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d, err := devnet.New(ctx, devnet.Options{
+		Operators: *operators,
+		Threshold: *threshold,
+		HttpPort:  *httpPort,
+		Logger:    slog.Default(),
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("starting devnet", "operators", len(d.Operators), "threshold", d.Threshold(),
+		"multisig", d.MultisigAddress(), "bitcoind", d.Bitcoind.Host())
+	d.Start()
+	defer d.Stop(context.Background())
+
+	recipient := common.HexToAddress(devnetRecipient)
+	var flows []devnetFlow
+	failed := 0
+	drive := func(flow devnetFlow, wait func(context.Context, uint64) (uint8, error)) devnetFlow {
+		waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		status, err := wait(waitCtx, flow.Id)
+		flow.Status = status
+		if err != nil {
+			flow.Error = err.Error()
+			failed++
+		}
+		return flow
+	}
+
+	for i := 0; i < *deposits; i++ {
+		id, err := d.Deposit(*amount, recipient)
+		if err != nil {
+			return err
+		}
+		flows = append(flows, drive(devnetFlow{Direction: "incoming", Id: id}, func(ctx context.Context, id uint64) (uint8, error) {
+			status, err := d.WaitIncoming(ctx, id)
+			return uint8(status), err
+		}))
+	}
+	for i := 0; i < *withdrawals; i++ {
+		id, err := d.Withdraw(recipient, *amount/2, *withdrawTo)
+		if err != nil {
+			return err
+		}
+		flow := drive(devnetFlow{Direction: "outgoing", Id: id}, func(ctx context.Context, id uint64) (uint8, error) {
+			status, err := d.WaitOutgoing(ctx, id)
+			return uint8(status), err
+		})
+		if flow.Error == "" {
+			if flow.Signatures, err = d.ValidSignatures(id); err != nil {
+				return err
+			}
+			if flow.Signatures < d.Threshold() {
+				flow.Error = fmt.Sprintf("%d valid signatures, threshold is %d", flow.Signatures, d.Threshold())
+				failed++
+			}
+		}
+		flows = append(flows, flow)
+	}
+
+	if err := printJSON(map[string]any{
+		"operators": len(d.Operators),
+		"threshold": d.Threshold(),
+		"multisig":  d.MultisigAddress(),
+		"flows":     flows,
+		"votes":     len(d.Gateway.Votes()),
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d flows did not reach the threshold", failed, len(flows))
+	}
+
+	if *keep {
+		slog.Info("devnet running, interrupt to stop")
+		<-ctx.Done()
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strconv"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+)
+
+func invoiceShowCommand() *command {
+	return &command{
+		name:        "show",
+		usage:       "show [--config path] [--outgoing] <id>",
+		description: "Print an incoming invoice or outgoing tx from the gateway",
+		run: func(args []string) error {
+			fs := newFlagSet("invoice show")
+			configPath := fs.String("config", defaultConfigPath, "path to the operator config file")
+			outgoing := fs.Bool("outgoing", false, "show the outgoing tx with this id instead of an incoming invoice")
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+			if fs.NArg() != 1 {
+				return fmt.Errorf("expected exactly one invoice id")
+			}
+			id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid invoice id %q: %w", fs.Arg(0), err)
+			}
+
+			cfg, err := config.LoadConfig(*configPath)
+			if err != nil {
+				return err
+			}
+			setupLogger(cfg.Log)
+			verifier, err := evm.NewVerifier(slog.Default(), cfg.Evm)
+			if err != nil {
+				return err
+			}
+
+			if *outgoing {
+				tx, err := verifier.GetOutgoingTx(context.Background(), new(big.Int).SetUint64(id))
+				if err != nil {
+					return err
+				}
+				return printJSON(tx)
+			}
+			invoice, err := verifier.GetIncomingInvoice(context.Background(), id)
+			if err != nil {
+				return err
+			}
+			return printJSON(invoice)
+		},
+	}
+}
@@ -1,30 +1,128 @@
 package main
 
 import (
-	"context"
-	"log/slog"
-
-	"github.com/aura-nw/lotus-operator/config"
-	"github.com/aura-nw/lotus-operator/internal/operator"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 )
 
 const (
 	defaultConfigPath = "./operator.toml"
+	defaultServerAddr = "http://localhost:5055"
+)
+
+// Exit codes of the operator process.
+const (
+	exitOK           = 0
+	exitFailure      = 1
+	exitDrainTimeout = 2
+)
+
+var (
+	GitCommit = ""
+	GitDate   = ""
 )
 
+// exitError makes the process exit with code instead of exitFailure.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// command is a CLI command, either runnable or a group of subcommands.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+	subcommands []*command
+}
+
+func commands() []*command {
+	return []*command{
+		runCommand(),
+		versionCommand(),
+		{
+			name:        "config",
+			description: "Inspect the operator configuration",
+			subcommands: []*command{configValidateCommand()},
+		},
+		statusCommand(),
+		{
+			name:        "invoice",
+			description: "Query gateway invoices",
+			subcommands: []*command{invoiceShowCommand()},
+		},
+		{
+			name:        "verify",
+			description: "Run one-off dry-run verifications",
+			subcommands: []*command{verifyDepositCommand()},
+		},
+		replayCommand(),
+		{
+			name:        "audit",
+			description: "Inspect the audit log",
+			subcommands: []*command{auditVerifyCommand()},
+		},
+		devnetCommand(),
+	}
+}
+
 func main() {
-	config, err := config.LoadConfig(defaultConfigPath)
-	if err != nil {
-		panic(err)
+	os.Exit(exitCode(dispatch("operator", commands(), os.Args[1:])))
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
 	}
+	return exitFailure
+}
 
-	ctx := context.Background()
+func dispatch(prefix string, cmds []*command, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(prefix, cmds)
+		return flag.ErrHelp
+	}
+	for _, cmd := range cmds {
+		if cmd.name != args[0] {
+			continue
+		}
+		if len(cmd.subcommands) > 0 {
+			return dispatch(prefix+" "+cmd.name, cmd.subcommands, args[1:])
+		}
+		return cmd.run(args[1:])
+	}
+	printUsage(prefix, cmds)
+	return fmt.Errorf("unknown command %q", strings.Join(args[:1], " "))
+}
 
-	operator, err := operator.NewOperator(ctx, &config, slog.Default())
-	if err != nil {
-		panic(err)
+func printUsage(prefix string, cmds []*command) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", prefix)
+	for _, cmd := range cmds {
+		usage := cmd.usage
+		if usage == "" {
+			usage = cmd.name
+		}
+		fmt.Fprintf(os.Stderr, "  %-32s %s\n", usage, cmd.description)
 	}
+}
 
-	operator.Start()
-	<-ctx.Done()
+// newFlagSet returns a flag set for cmd that reports errors instead of exiting.
+func newFlagSet(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
 }
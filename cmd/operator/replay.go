@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator"
+)
+
+func replayCommand() *command {
+	return &command{
+		name:        "replay",
+		usage:       "replay [--config path] [--outgoing] [--replay file] --from id [--to id]",
+		description: "Re-run verification of past invoices and diff against on-chain votes",
+		run: func(args []string) error {
+			fs := newFlagSet("replay")
+			configPath := fs.String("config", defaultConfigPath, "path to the operator config file")
+			outgoing := fs.Bool("outgoing", false, "replay outgoing txs instead of incoming invoices")
+			from := fs.Uint64("from", 0, "first id to replay")
+			to := fs.Uint64("to", 0, "last id to replay, --from when 0")
+			trace := addTraceFlags(fs)
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+			if *from == 0 {
+				return fmt.Errorf("--from is required")
+			}
+			if *to == 0 {
+				*to = *from
+			}
+
+			cfg, err := config.LoadConfig(*configPath)
+			if err != nil {
+				return err
+			}
+			setupLogger(cfg.Log)
+			transport, closeTrace, err := trace.transport()
+			if err != nil {
+				return err
+			}
+			defer closeTrace()
+			// The operator is never started: no loop runs and no vote is sent.
+			// Replayed verdicts are not decisions, keep them out of the audit log
+			cfg.Audit = config.AuditInfo{}
+			op, err := operator.NewOperatorWithTransport(context.Background(), &cfg, slog.Default(), transport)
+			if err != nil {
+				return err
+			}
+			results, err := op.Replay(*outgoing, *from, *to)
+			if err != nil {
+				return err
+			}
+
+			diffs := 0
+			for _, result := range results {
+				if result.Diff != "" {
+					diffs++
+				}
+			}
+			if err := printJSON(map[string]any{
+				"results": results,
+				"diffs":   diffs,
+			}); err != nil {
+				return err
+			}
+			if diffs > 0 {
+				return fmt.Errorf("%d of %d replayed verdicts differ from the chain", diffs, len(results))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
+)
+
+const (
+	defaultShutdownTimeout = 30
+	tracingFlushTimeout    = 5 * time.Second
+)
+
+func runCommand() *command {
+	return &command{
+		name:        "run",
+		usage:       "run [--config path] [--record file | --replay file]",
+		description: "Run the operator service",
+		run:         runOperator,
+	}
+}
+
+func runOperator(args []string) error {
+	fs := newFlagSet("run")
+	configPath := fs.String("config", defaultConfigPath, "path to the operator config file")
+	trace := addTraceFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	transport, closeTrace, err := trace.transport()
+	if err != nil {
+		return err
+	}
+	defer closeTrace()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The level follows log.level when the config file is reloaded
+	level := setupLogger(cfg.Log)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing, GitCommit)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("flush traces error", "err", err)
+		}
+	}()
+
+	op, err := operator.NewOperatorWithTransport(ctx, &cfg, slog.Default(), transport)
+	if err != nil {
+		return err
+	}
+	op.EnableReload(*configPath, level)
+
+	slog.Info("starting lotus operator", "git_commit", GitCommit, "git_date", GitDate, "config_version", cfg.Version)
+	op.Start()
+	<-ctx.Done()
+	// Restore default signal handling, a second signal kills the process
+	stop()
+
+	timeout := op.Config().Server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	slog.Info("shutdown signal received, draining", "timeout", time.Duration(timeout)*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	if err := op.Stop(shutdownCtx); err != nil {
+		if errors.Is(err, operator.ErrDrainTimeout) {
+			return &exitError{code: exitDrainTimeout, err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// setupLogger makes the default logger write to stderr in the configured
+// format and level. The returned level can be changed afterwards.
+func setupLogger(info config.LogInfo) *slog.LevelVar {
+	level := new(slog.LevelVar)
+	lvl, _ := info.SlogLevel()
+	level.Set(lvl)
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if info.Format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return level
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func statusCommand() *command {
+	return &command{
+		name:        "status",
+		usage:       "status [--addr url]",
+		description: "Query the status of a running operator",
+		run: func(args []string) error {
+			fs := newFlagSet("status")
+			addr := fs.String("addr", defaultServerAddr, "base url of the operator HTTP server")
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+
+			client := &http.Client{Timeout: 10 * time.Second}
+			resp, err := client.Get(strings.TrimSuffix(*addr, "/") + "/status")
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("status request failed: %s: %s", resp.Status, body)
+			}
+
+			var out bytes.Buffer
+			if err := json.Indent(&out, body, "", "  "); err != nil {
+				return err
+			}
+			_, err = out.WriteTo(os.Stdout)
+			return err
+		},
+	}
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/aura-nw/lotus-operator/internal/rpctrace"
+)
+
+// traceFlags selects an rpctrace transport for the chain clients.
+type traceFlags struct {
+	record *string
+	replay *string
+}
+
+func addTraceFlags(fs *flag.FlagSet) traceFlags {
+	return traceFlags{
+		record: fs.String("record", "", "append the rpc requests to both chains and their responses to this trace file"),
+		replay: fs.String("replay", "", "answer the rpc requests to both chains from this trace file instead of the nodes"),
+	}
+}
+
+// transport returns the transport the flags ask for, nil when none, and the
+// function releasing it.
+func (f traceFlags) transport() (http.RoundTripper, func(), error) {
+	switch {
+	case *f.record != "" && *f.replay != "":
+		return nil, nil, fmt.Errorf("--record and --replay are exclusive")
+	case *f.record != "":
+		recorder, err := rpctrace.NewRecorder(*f.record, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return recorder, func() { recorder.Close() }, nil
+	case *f.replay != "":
+		replayer, err := rpctrace.NewReplayer(*f.replay)
+		if err != nil {
+			return nil, nil, err
+		}
+		return replayer, func() {}, nil
+	}
+	return nil, func() {}, nil
+}
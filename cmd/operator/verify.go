@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+)
+
+func verifyDepositCommand() *command {
+	return &command{
+		name:        "deposit",
+		usage:       "deposit [flags] <txid>",
+		description: "Verify a bitcoin deposit without voting",
+		run: func(args []string) error {
+			fs := newFlagSet("verify deposit")
+			configPath := fs.String("config", defaultConfigPath, "path to the operator config file")
+			amount := fs.Uint64("amount", 0, "expected deposit amount in satoshi, required")
+			recipient := fs.String("recipient", "", "expected EVM recipient address")
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+			if fs.NArg() != 1 {
+				return fmt.Errorf("expected exactly one txid")
+			}
+			if *amount == 0 {
+				return fmt.Errorf("--amount is required")
+			}
+
+			cfg, err := config.LoadConfig(*configPath)
+			if err != nil {
+				return err
+			}
+			setupLogger(cfg.Log)
+			verifier, err := bitcoin.NewVerifier(slog.Default(), cfg.Bitcoin)
+			if err != nil {
+				return err
+			}
+
+			utxo := bitcoin.UtxoDef{
+				TxHash:   fs.Arg(0),
+				Amount:   *amount,
+				Receiver: *recipient,
+			}
+			valid, confirmations, err := verifier.VerifyBtcDeposit(context.Background(), utxo.String(), *amount, *recipient)
+			if err != nil {
+				return err
+			}
+			return printJSON(map[string]any{
+				"txid":          utxo.TxHash,
+				"amount":        *amount,
+				"recipient":     *recipient,
+				"valid":         valid,
+				"confirmations": confirmations,
+			})
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+func versionCommand() *command {
+	return &command{
+		name:        "version",
+		description: "Print the operator version",
+		run: func(args []string) error {
+			commit := GitCommit
+			if commit == "" {
+				commit = "unknown"
+			}
+			date := GitDate
+			if ts, err := strconv.ParseInt(GitDate, 10, 64); err == nil {
+				date = time.Unix(ts, 0).UTC().Format(time.RFC3339)
+			}
+			if date == "" {
+				date = "unknown"
+			}
+			fmt.Printf("commit:     %s\n", commit)
+			fmt.Printf("date:       %s\n", date)
+			fmt.Printf("go version: %s\n", runtime.Version())
+			return nil
+		},
+	}
+}
@@ -1,41 +1,132 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
+// Operator modes accepted in mode.
+const (
+	// ModeVote verifies invoices and votes on them, the default
+	ModeVote = "vote"
+	// ModeShadow verifies settled invoices without voting and reports the
+	// verdicts disagreeing with the chain
+	ModeShadow = "shadow"
+)
+
+// Fields tagged reload:"live" can change while the operator runs, see
+// Diff. Every other field needs a restart.
 type Config struct {
+	Mode    string      `toml:"mode"`
 	Server  ServerInfo  `toml:"server"`
+	Log     LogInfo     `toml:"log"`
 	Evm     EvmInfo     `toml:"evm"`
 	Bitcoin BitcoinInfo `toml:"bitcoin"`
+	Audit   AuditInfo   `toml:"audit"`
+	Tracing TracingInfo `toml:"tracing"`
+
+	// Version identifies the config file content the config was loaded from
+	Version string `toml:"-"`
+}
+
+// Shadow reports whether the operator runs in shadow mode.
+func (c *Config) Shadow() bool {
+	return c.Mode == ModeShadow
 }
 
 type ServerInfo struct {
-	HttpPort string `toml:"http-port"`
+	HttpPort        string `toml:"http-port"`
+	ReadyLoopTicks  int64  `toml:"ready-loop-ticks" reload:"live"`
+	MaxEvmHeadAge   int64  `toml:"max-evm-head-age" reload:"live"`
+	ShutdownTimeout int64  `toml:"shutdown-timeout" reload:"live"`
+}
+
+// AuditInfo configures the audit log of decisions and signatures, disabled
+// when Path is empty.
+type AuditInfo struct {
+	Path string `toml:"path"`
+	// Sign signs each entry with the evm private key
+	Sign bool `toml:"sign"`
+}
+
+// Tracing exporters.
+const (
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// TracingInfo configures the OpenTelemetry spans of invoice processing,
+// disabled when Exporter is empty.
+type TracingInfo struct {
+	// Exporter is otlp, over http, or stdout
+	Exporter string `toml:"exporter"`
+	// Endpoint is the host:port of the otlp collector, the OTEL_EXPORTER_OTLP_*
+	// environment variables or localhost:4318 when empty
+	Endpoint string `toml:"endpoint"`
+	Insecure bool   `toml:"insecure"`
+	// SampleRatio is the share of invoices traced, all of them when zero
+	SampleRatio float64 `toml:"sample-ratio"`
+}
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+type LogInfo struct {
+	Level string `toml:"level" reload:"live"`
+	// Format is text or json, text when unset
+	Format string `toml:"format"`
 }
 
 type BitcoinInfo struct {
-	Network          string `toml:"network"`
-	Host             string `toml:"host"`
-	User             string `toml:"user"`
-	Pass             string `toml:"pass"`
+	Network     string   `toml:"network"`
+	Host        string   `toml:"host"`
+	BackupHosts []string `toml:"backup-hosts"`
+	User        string   `toml:"user"`
+	Pass        string   `toml:"pass" secret:"true"`
+	CookieFile  string   `toml:"cookie-file"`
+	TLS         bool     `toml:"tls"`
+	CACert      string   `toml:"ca-cert"`
+	CallTimeout uint64   `toml:"call-timeout"`
+	// Retries is nil when unset, 0 disables retries
+	Retries      *int64   `toml:"retries"`
+	MaxBlockLag  int64    `toml:"max-block-lag"`
+	Backends     []string `toml:"backends"`
+	EsploraUrl   string   `toml:"esplora-url"`
+	ElectrumHost string   `toml:"electrum-host"`
+	ElectrumTLS  bool     `toml:"electrum-tls"`
+	// QueryInterval is not read yet, bitcoin is only queried for the
+	// invoices the evm loops pick up
 	QueryInterval    int64  `toml:"query-interval"`
-	MinConfirmations int64  `toml:"min-confirmations"`
+	MinConfirmations int64  `toml:"min-confirmations" reload:"live"`
 	MultisigAddress  string `toml:"multisig-address"`
 	RedeemScript     string `toml:"redeem-script"`
-	PrivateKey       string `toml:"private-key"`
+	SignetChallenge  string `toml:"signet-challenge"`
+	PrivateKey       string `toml:"private-key" secret:"true"`
 }
 
 type EvmInfo struct {
 	Url              string      `toml:"url"`
+	BackupUrls       []string    `toml:"backup-urls"`
+	Quorum           int64       `toml:"quorum" reload:"live"`
 	ChainID          int64       `toml:"chain-id"`
-	QueryInterval    int64       `toml:"query-interval"`
-	MinConfirmations int64       `toml:"min-confirmations"`
-	PrivateKey       string      `toml:"private-key"`
+	QueryInterval    int64       `toml:"query-interval" reload:"live"`
+	MinConfirmations int64       `toml:"min-confirmations" reload:"live"`
+	PrivateKey       string      `toml:"private-key" secret:"true"`
 	Contracts        EvmContract `toml:"contracts"`
-	CallTimeout      uint64      `toml:"call-timeout"`
+	CallTimeout      uint64      `toml:"call-timeout" reload:"live"`
+	MaxGasPrice      string      `toml:"max-gas-price" reload:"live"`
+
+	BalanceCheckInterval int64  `toml:"balance-check-interval" reload:"live"`
+	LowBalanceThreshold  string `toml:"low-balance-threshold" reload:"live"`
+	VoteGasLimit         uint64 `toml:"vote-gas-limit" reload:"live"`
 }
 
 type EvmContract struct {
@@ -43,14 +134,40 @@ type EvmContract struct {
 	GatewayAddr    string `toml:"gateway-addr"`
 }
 
-// LoadConfig loads config from toml file to OperatorConfig
+// LoadConfig loads config from toml file to OperatorConfig, applies the
+// LOTUS_* environment overrides and validates it
 func LoadConfig(path string) (Config, error) {
 	var config Config
 
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read TOML configuration: %w", err)
+	}
+	sum := sha256.Sum256(bz)
+	config.Version = hex.EncodeToString(sum[:6])
+
 	// Decode the TOML file into the config struct
-	if _, err := toml.DecodeFile(path, &config); err != nil {
+	md, err := toml.Decode(string(bz), &config)
+	if err != nil {
 		return config, fmt.Errorf("failed to decode TOML configuration: %w", err)
 	}
 
+	// Reject unknown keys, they are most likely typos
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return config, fmt.Errorf("unknown keys in TOML configuration: %s", strings.Join(keys, ", "))
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return config, fmt.Errorf("failed to apply environment overrides: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
@@ -1,9 +1,13 @@
 package config_test
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aura-nw/lotus-operator/config"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,3 +16,139 @@ func TestLoadConfig(t *testing.T) {
 	require.NoError(t, err)
 	t.Log("config: ", c)
 }
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	bz, err := os.ReadFile("../operator.toml")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "operator.toml")
+	bz = bytes.Replace(bz, []byte("chain-id ="), []byte("chain_id ="), 1)
+	require.NoError(t, os.WriteFile(path, bz, 0o600))
+
+	_, err = config.LoadConfig(path)
+	require.ErrorContains(t, err, "evm.chain_id")
+}
+
+func TestValidate(t *testing.T) {
+	base, err := config.LoadConfig("../operator.toml")
+	require.NoError(t, err)
+	require.NoError(t, base.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(c *config.Config)
+		field  string
+	}{
+		{"audit signed without path", func(c *config.Config) { c.Audit.Sign = true }, "audit.sign"},
+		{"unknown mode", func(c *config.Config) { c.Mode = "dry-run" }, "mode"},
+		{"unknown log format", func(c *config.Config) { c.Log.Format = "logfmt" }, "log.format"},
+		{"unknown tracing exporter", func(c *config.Config) { c.Tracing.Exporter = "jaeger" }, "tracing.exporter"},
+		{"tracing sample ratio above one", func(c *config.Config) { c.Tracing.SampleRatio = 2 }, "tracing.sample-ratio"},
+		{"zero evm query interval", func(c *config.Config) { c.Evm.QueryInterval = 0 }, "evm.query-interval"},
+		{"zero bitcoin query interval", func(c *config.Config) { c.Bitcoin.QueryInterval = 0 }, "bitcoin.query-interval"},
+		{"invalid http port", func(c *config.Config) { c.Server.HttpPort = "http" }, "server.http-port"},
+		{"invalid gateway address", func(c *config.Config) { c.Evm.Contracts.GatewayAddr = "0x1234" }, "evm.contracts.gateway-addr"},
+		{"quorum above endpoints", func(c *config.Config) { c.Evm.Quorum = 2 }, "evm.quorum"},
+		{"invalid backup url", func(c *config.Config) { c.Evm.BackupUrls = []string{"localhost"} }, "evm.backup-urls[0]"},
+		{"invalid evm key", func(c *config.Config) { c.Evm.PrivateKey = "zz" }, "evm.private-key"},
+		{"unknown network", func(c *config.Config) { c.Bitcoin.Network = "testnet" }, "bitcoin.network"},
+		{"network mismatch", func(c *config.Config) { c.Bitcoin.Network = "mainnet" }, "bitcoin.multisig-address"},
+		{"backup host same as host", func(c *config.Config) { c.Bitcoin.BackupHosts = []string{c.Bitcoin.Host} }, "bitcoin.backup-hosts[0]"},
+		{"ca cert without tls", func(c *config.Config) { c.Bitcoin.CACert = "../operator.toml" }, "bitcoin.ca-cert"},
+		{"missing cookie file", func(c *config.Config) { c.Bitcoin.CookieFile = "missing/.cookie" }, "bitcoin.cookie-file"},
+		{"unknown backend", func(c *config.Config) { c.Bitcoin.Backends = []string{"bitcoind", "blockbook"} }, "bitcoin.backends[1]"},
+		{"esplora without url", func(c *config.Config) { c.Bitcoin.Backends = []string{"bitcoind", "esplora"} }, "bitcoin.esplora-url"},
+		{"invalid redeem script", func(c *config.Config) { c.Bitcoin.RedeemScript = "51" }, "bitcoin.redeem-script"},
+		{
+			"key not in redeem script",
+			func(c *config.Config) { c.Bitcoin.PrivateKey = "cVt4o7BGAig1UXywgGSmARhxMdzP5qvQsxKkSsc1XEkw3tDTQFpy" },
+			"bitcoin.private-key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			tt.modify(&c)
+			err := c.Validate()
+			var validationErr config.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Len(t, validationErr, 1, err.Error())
+			require.Equal(t, tt.field, validationErr[0].Field)
+		})
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "bitcoin-pass")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file-pass\n"), 0o600))
+
+	t.Setenv("LOTUS_SERVER_HTTP_PORT", "6060")
+	t.Setenv("LOTUS_EVM_QUERY_INTERVAL", "12")
+	t.Setenv("LOTUS_EVM_CONTRACTS_GATEWAY_ADDR", "0x0000000000000000000000000000000000000001")
+	t.Setenv("LOTUS_BITCOIN_PASS_FILE", secretFile)
+	t.Setenv("LOTUS_BITCOIN_RETRIES", "0")
+	t.Setenv("LOTUS_TRACING_SAMPLE_RATIO", "0.5")
+	t.Setenv("LOTUS_EVM_PRIVATE_KEY", "444a26796811d3b86bd1c3b85d04b9b078e4eee66203096f04081b245d6e4123")
+	t.Setenv("LOTUS_EVM_PRIVATE_KEY_FILE", "/does/not/matter")
+
+	c, err := config.LoadConfig("../operator.toml")
+	require.NoError(t, err)
+	require.Equal(t, "6060", c.Server.HttpPort)
+	require.Equal(t, int64(12), c.Evm.QueryInterval)
+	require.Equal(t, "0x0000000000000000000000000000000000000001", c.Evm.Contracts.GatewayAddr)
+	require.Equal(t, "file-pass", c.Bitcoin.Pass)
+	require.Equal(t, int64(0), *c.Bitcoin.Retries)
+	require.Equal(t, 0.5, c.Tracing.SampleRatio)
+	// The variable takes precedence over its _FILE variant
+	require.Equal(t, "444a26796811d3b86bd1c3b85d04b9b078e4eee66203096f04081b245d6e4123", c.Evm.PrivateKey)
+}
+
+func TestLoadConfigEnvInvalid(t *testing.T) {
+	t.Setenv("LOTUS_EVM_CHAIN_ID", "aura")
+	_, err := config.LoadConfig("../operator.toml")
+	require.ErrorContains(t, err, "LOTUS_EVM_CHAIN_ID")
+
+	t.Setenv("LOTUS_EVM_CHAIN_ID", "1235")
+	t.Setenv("LOTUS_BITCOIN_PRIVATE_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = config.LoadConfig("../operator.toml")
+	require.ErrorContains(t, err, "LOTUS_BITCOIN_PRIVATE_KEY_FILE")
+}
+
+func TestChainParams(t *testing.T) {
+	info := config.BitcoinInfo{Network: config.NetworkTestnet4}
+	params, err := info.ChainParams()
+	require.NoError(t, err)
+	require.Equal(t, "tb", params.Bech32HRPSegwit)
+	require.NotEqual(t, chaincfg.TestNet3Params.GenesisHash, params.GenesisHash)
+
+	info = config.BitcoinInfo{Network: config.NetworkSignet, SignetChallenge: "51"}
+	params, err = info.ChainParams()
+	require.NoError(t, err)
+	require.Equal(t, "signet", params.Name)
+	require.NotEqual(t, chaincfg.SigNetParams.Net, params.Net)
+
+	info = config.BitcoinInfo{Network: config.NetworkSignet, SignetChallenge: "zz"}
+	_, err = info.ChainParams()
+	require.Error(t, err)
+
+	info = config.BitcoinInfo{Network: "testnet"}
+	_, err = info.ChainParams()
+	require.ErrorContains(t, err, "unknown network")
+}
+
+func TestDiff(t *testing.T) {
+	old, err := config.LoadConfig("../operator.toml")
+	require.NoError(t, err)
+
+	next := old
+	live, immutable := config.Diff(&old, &next)
+	require.Empty(t, live)
+	require.Empty(t, immutable)
+
+	next.Evm.QueryInterval = 12
+	next.Log.Level = "debug"
+	next.Evm.Contracts.GatewayAddr = "0x0000000000000000000000000000000000000001"
+	next.Bitcoin.QueryInterval = 30
+	live, immutable = config.Diff(&old, &next)
+	require.Equal(t, []string{"log.level", "evm.query-interval"}, live)
+	require.Equal(t, []string{"evm.contracts.gateway-addr", "bitcoin.query-interval"}, immutable)
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "LOTUS"
+
+// envLookup is the signature of os.LookupEnv.
+type envLookup func(key string) (string, bool)
+
+// applyEnv overrides config fields with environment variables. Every field
+// maps to LOTUS_<SECTION>_<KEY>, its toml path upper-cased with dashes and
+// dots replaced by underscores, e.g. evm.private-key is LOTUS_EVM_PRIVATE_KEY.
+// Fields tagged secret also accept LOTUS_<SECTION>_<KEY>_FILE, the path of a
+// file holding the value. The precedence is, highest first: the variable,
+// the _FILE variable, the toml value.
+func (c *Config) applyEnv(lookup envLookup) error {
+	return applyEnvStruct(reflect.ValueOf(c).Elem(), envPrefix, lookup)
+}
+
+func applyEnvStruct(v reflect.Value, prefix string, lookup envLookup) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("toml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(strings.ReplaceAll(tag, "-", "_"))
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnvStruct(fv, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		source := name
+		if !ok && field.Tag.Get("secret") == "true" {
+			var err error
+			source = name + "_FILE"
+			if value, ok, err = lookupFile(source, lookup); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(fv, source, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lookupFile(name string, lookup envLookup) (string, bool, error) {
+	path, ok := lookup(name)
+	if !ok {
+		return "", false, nil
+	}
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimRight(string(bz), "\r\n"), true, nil
+}
+
+func setField(fv reflect.Value, name, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", name, value)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid unsigned integer %q", name, value)
+		}
+		fv.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", name, value)
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", name, value)
+		}
+		fv.SetBool(b)
+	case reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), name, value); err != nil {
+			return err
+		}
+		fv.Set(elem)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported type %s", name, fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", name, fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// SlogLevel returns the configured log level, info when unset.
+func (l *LogInfo) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if l.Level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return level, fmt.Errorf("unknown level %q", l.Level)
+	}
+	return level, nil
+}
+
+// Diff returns the toml paths of the fields that differ between old and
+// next, split between fields that can be applied live and fields that need
+// a restart.
+func Diff(old, next *Config) (live, immutable []string) {
+	diffStruct(reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem(), "", &live, &immutable)
+	return live, immutable
+}
+
+func diffStruct(old, next reflect.Value, prefix string, live, immutable *[]string) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("toml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		path := strings.TrimPrefix(prefix+"."+tag, ".")
+
+		if field.Type.Kind() == reflect.Struct {
+			diffStruct(old.Field(i), next.Field(i), path, live, immutable)
+			continue
+		}
+		if reflect.DeepEqual(old.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		if field.Tag.Get("reload") == "live" {
+			*live = append(*live, path)
+		} else {
+			*immutable = append(*immutable, path)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// FieldError is a validation error of one config field.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+// ValidationError lists every invalid field of a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) addf(field, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) positive(field string, value int64) {
+	if value <= 0 {
+		v.addf(field, "must be positive, got %d", value)
+	}
+}
+
+func (v *validator) nonNegative(field string, value int64) {
+	if value < 0 {
+		v.addf(field, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.addf(field, "is required")
+		return false
+	}
+	return true
+}
+
+// Validate checks ranges, formats and consistency of the config. The
+// returned error is a ValidationError naming every offending field.
+func (c *Config) Validate() error {
+	v := &validator{}
+	switch c.Mode {
+	case "", ModeVote, ModeShadow:
+	default:
+		v.addf("mode", "must be %q or %q, got %q", ModeVote, ModeShadow, c.Mode)
+	}
+	c.Server.validate(v)
+	c.Log.validate(v)
+	if c.Audit.Sign && c.Audit.Path == "" {
+		v.addf("audit.sign", "requires audit.path")
+	}
+	c.Tracing.validate(v)
+	c.Bitcoin.validate(v)
+	c.Evm.validate(v)
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (s *ServerInfo) validate(v *validator) {
+	if v.required("server.http-port", s.HttpPort) {
+		if port, err := strconv.ParseUint(s.HttpPort, 10, 16); err != nil || port == 0 {
+			v.addf("server.http-port", "must be a port number, got %q", s.HttpPort)
+		}
+	}
+	v.nonNegative("server.ready-loop-ticks", s.ReadyLoopTicks)
+	v.nonNegative("server.max-evm-head-age", s.MaxEvmHeadAge)
+	v.nonNegative("server.shutdown-timeout", s.ShutdownTimeout)
+}
+
+func (l *LogInfo) validate(v *validator) {
+	if _, err := l.SlogLevel(); err != nil {
+		v.addf("log.level", "%s", err)
+	}
+	switch l.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		v.addf("log.format", "must be %s or %s, got %q", LogFormatText, LogFormatJSON, l.Format)
+	}
+}
+
+func (t *TracingInfo) validate(v *validator) {
+	switch t.Exporter {
+	case "", TracingOTLP, TracingStdout:
+	default:
+		v.addf("tracing.exporter", "must be %s or %s, got %q", TracingOTLP, TracingStdout, t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		v.addf("tracing.sample-ratio", "must be between 0 and 1, got %v", t.SampleRatio)
+	}
+}
+
+func (b *BitcoinInfo) validate(v *validator) {
+	params, err := b.ChainParams()
+	if err != nil {
+		v.addf("bitcoin.network", "%s", err)
+	}
+	backends := b.Backends
+	if len(backends) == 0 {
+		backends = []string{BackendBitcoind}
+	}
+	seen := make(map[string]bool)
+	for i, backend := range backends {
+		field := fmt.Sprintf("bitcoin.backends[%d]", i)
+		switch {
+		case backend != BackendBitcoind && backend != BackendEsplora && backend != BackendElectrum:
+			v.addf(field, "unknown backend %q, expected one of %s, %s, %s", backend, BackendBitcoind, BackendEsplora, BackendElectrum)
+		case seen[backend]:
+			v.addf(field, "duplicate backend %q", backend)
+		}
+		seen[backend] = true
+	}
+	if seen[BackendBitcoind] {
+		v.required("bitcoin.host", b.Host)
+	}
+	if seen[BackendEsplora] && v.required("bitcoin.esplora-url", b.EsploraUrl) {
+		if u, err := url.Parse(b.EsploraUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			v.addf("bitcoin.esplora-url", "must be an absolute url, got %q", b.EsploraUrl)
+		}
+	}
+	if seen[BackendElectrum] {
+		v.required("bitcoin.electrum-host", b.ElectrumHost)
+	}
+	for i, host := range b.BackupHosts {
+		if host == "" || host == b.Host {
+			v.addf(fmt.Sprintf("bitcoin.backup-hosts[%d]", i), "must be a host other than bitcoin.host, got %q", host)
+		}
+	}
+	if b.CookieFile != "" {
+		if _, err := os.Stat(b.CookieFile); err != nil {
+			v.addf("bitcoin.cookie-file", "%s", err)
+		}
+	}
+	if b.CACert != "" {
+		if !b.TLS {
+			v.addf("bitcoin.ca-cert", "requires bitcoin.tls")
+		} else if pem, err := os.ReadFile(b.CACert); err != nil {
+			v.addf("bitcoin.ca-cert", "%s", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			v.addf("bitcoin.ca-cert", "no PEM certificate in %s", b.CACert)
+		}
+	}
+	if b.Retries != nil {
+		v.nonNegative("bitcoin.retries", *b.Retries)
+	}
+	v.nonNegative("bitcoin.max-block-lag", b.MaxBlockLag)
+	v.positive("bitcoin.query-interval", b.QueryInterval)
+	v.nonNegative("bitcoin.min-confirmations", b.MinConfirmations)
+
+	if v.required("bitcoin.multisig-address", b.MultisigAddress) && params != nil {
+		addr, err := btcutil.DecodeAddress(b.MultisigAddress, params)
+		if err != nil {
+			v.addf("bitcoin.multisig-address", "invalid address: %s", err)
+		} else if !addr.IsForNet(params) {
+			v.addf("bitcoin.multisig-address", "address %s is not for network %s", b.MultisigAddress, b.Network)
+		}
+	}
+
+	var pubKeys [][]byte
+	if v.required("bitcoin.redeem-script", b.RedeemScript) {
+		script, err := hex.DecodeString(b.RedeemScript)
+		if err != nil {
+			v.addf("bitcoin.redeem-script", "invalid hex: %s", err)
+		} else if pubKeys, err = multisigPubKeys(script); err != nil {
+			v.addf("bitcoin.redeem-script", "%s", err)
+		}
+	}
+
+	if v.required("bitcoin.private-key", b.PrivateKey) {
+		wif, err := btcutil.DecodeWIF(b.PrivateKey)
+		if err != nil {
+			v.addf("bitcoin.private-key", "invalid WIF: %s", err)
+		} else if pubKeys != nil && !containsPubKey(pubKeys, wif.PrivKey.PubKey()) {
+			v.addf("bitcoin.private-key", "public key is not part of bitcoin.redeem-script")
+		}
+	}
+}
+
+func (e *EvmInfo) validate(v *validator) {
+	if v.required("evm.url", e.Url) {
+		if u, err := url.Parse(e.Url); err != nil || u.Scheme == "" || u.Host == "" {
+			v.addf("evm.url", "must be an absolute url, got %q", e.Url)
+		}
+	}
+	for i, backup := range e.BackupUrls {
+		if u, err := url.Parse(backup); err != nil || u.Scheme == "" || u.Host == "" {
+			v.addf(fmt.Sprintf("evm.backup-urls[%d]", i), "must be an absolute url, got %q", backup)
+		}
+	}
+	v.nonNegative("evm.quorum", e.Quorum)
+	if endpoints := int64(1 + len(e.BackupUrls)); e.Quorum > endpoints {
+		v.addf("evm.quorum", "must not exceed the %d configured endpoints, got %d", endpoints, e.Quorum)
+	}
+	v.positive("evm.chain-id", e.ChainID)
+	v.positive("evm.query-interval", e.QueryInterval)
+	v.nonNegative("evm.min-confirmations", e.MinConfirmations)
+	if e.CallTimeout == 0 {
+		v.addf("evm.call-timeout", "must be positive, got 0")
+	}
+	if v.required("evm.private-key", e.PrivateKey) {
+		if _, err := crypto.HexToECDSA(e.PrivateKey); err != nil {
+			v.addf("evm.private-key", "invalid key: %s", err)
+		}
+	}
+	if v.required("evm.contracts.gateway-addr", e.Contracts.GatewayAddr) && !common.IsHexAddress(e.Contracts.GatewayAddr) {
+		v.addf("evm.contracts.gateway-addr", "invalid address %q", e.Contracts.GatewayAddr)
+	}
+	if e.Contracts.WrappedBtcAddr != "" && !common.IsHexAddress(e.Contracts.WrappedBtcAddr) {
+		v.addf("evm.contracts.wrapped-btc-addr", "invalid address %q", e.Contracts.WrappedBtcAddr)
+	}
+	if e.MaxGasPrice != "" {
+		if _, ok := new(big.Int).SetString(e.MaxGasPrice, 10); !ok {
+			v.addf("evm.max-gas-price", "must be an amount in wei, got %q", e.MaxGasPrice)
+		}
+	}
+	v.nonNegative("evm.balance-check-interval", e.BalanceCheckInterval)
+	if e.LowBalanceThreshold != "" {
+		if _, ok := new(big.Int).SetString(e.LowBalanceThreshold, 10); !ok {
+			v.addf("evm.low-balance-threshold", "must be an amount in wei, got %q", e.LowBalanceThreshold)
+		}
+	}
+}
+
+// multisigPubKeys returns the public keys of a bare multisig script.
+func multisigPubKeys(script []byte) ([][]byte, error) {
+	if txscript.GetScriptClass(script) != txscript.MultiSigTy {
+		return nil, fmt.Errorf("not a multisig script")
+	}
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return nil, err
+	}
+	var pubKeys [][]byte
+	for _, data := range pushes {
+		if len(data) == 33 || len(data) == 65 {
+			pubKeys = append(pubKeys, data)
+		}
+	}
+	return pubKeys, nil
+}
+
+func containsPubKey(pubKeys [][]byte, pubKey *btcec.PublicKey) bool {
+	for _, pk := range pubKeys {
+		if bytes.Equal(pk, pubKey.SerializeCompressed()) || bytes.Equal(pk, pubKey.SerializeUncompressed()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+// Package audit keeps an append-only, tamper-evident log of the operator
+// decisions and signatures.
+//
+// The log is a file of JSON lines, one Entry per line. Each entry holds the
+// hash of the previous one, so editing, removing or reordering entries
+// breaks the chain from there on. Entries may also be signed with the
+// operator EVM key. Truncating the end of the log keeps a valid chain: keep
+// the last hash somewhere else to detect it.
+package audit
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Entry kinds written by the operator.
+const (
+	// KindVerdict is an invoice or tx evaluated, with its inputs, verdict
+	// and vote
+	KindVerdict = "verdict"
+	// KindSignature is a bitcoin sighash signed
+	KindSignature = "signature"
+)
+
+// GenesisHash is the previous hash of the first entry.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// ErrTampered is returned by Verify when the log does not hold together.
+var ErrTampered = errors.New("audit log tampered")
+
+// Entry is one record of the audit log.
+type Entry struct {
+	Seq      uint64          `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Kind     string          `json:"kind"`
+	Data     json.RawMessage `json:"data"`
+	PrevHash string          `json:"prev_hash"`
+	// Signer is the address of the key that signed the entry, if any
+	Signer    string `json:"signer,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// digest returns the hash of e without its hash and signature.
+func (e Entry) digest() ([]byte, error) {
+	e.Hash, e.Signature = "", ""
+	bz, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(bz)
+	return sum[:], nil
+}
+
+// Log appends entries to an audit log file.
+type Log struct {
+	key *ecdsa.PrivateKey
+
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// Open opens the audit log at path for appending, creating it if missing.
+// Entries are signed with key unless it is nil. The chain is resumed from
+// the last entry, which must be intact.
+func Open(path string, key *ecdsa.PrivateKey) (*Log, error) {
+	l := &Log{key: key, last: GenesisHash}
+	if f, err := os.Open(path); err == nil {
+		last, err := lastEntry(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read audit log %s: %w", path, err)
+		}
+		if last != nil {
+			l.seq, l.last = last.Seq, last.Hash
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.file = file
+	return l, nil
+}
+
+func lastEntry(r io.Reader) (*Entry, error) {
+	var last *Entry
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		last = &e
+	}
+	return last, scanner.Err()
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	return scanner
+}
+
+// Head returns the sequence number and hash of the last entry.
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.last
+}
+
+// Append writes an entry of kind holding data, encoded as JSON, and syncs
+// it to disk.
+func (l *Log) Append(kind string, data any) error {
+	bz, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := Entry{
+		Seq:      l.seq + 1,
+		Time:     time.Now().UTC(),
+		Kind:     kind,
+		Data:     bz,
+		PrevHash: l.last,
+	}
+	if l.key != nil {
+		e.Signer = crypto.PubkeyToAddress(l.key.PublicKey).Hex()
+	}
+	digest, err := e.digest()
+	if err != nil {
+		return err
+	}
+	e.Hash = hex.EncodeToString(digest)
+	if l.key != nil {
+		sig, err := crypto.Sign(digest, l.key)
+		if err != nil {
+			return err
+		}
+		e.Signature = hex.EncodeToString(sig)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Report sums up a verified audit log.
+type Report struct {
+	Entries  int            `json:"entries"`
+	Signed   int            `json:"signed"`
+	Signers  []string       `json:"signers,omitempty"`
+	Kinds    map[string]int `json:"kinds"`
+	LastSeq  uint64         `json:"last_seq"`
+	LastHash string         `json:"last_hash"`
+}
+
+// Verify reads an audit log and checks that every entry follows the
+// previous one, hashes to its hash and, when signed, is signed by its
+// signer. If signer is not the zero address every entry must be signed by
+// it. The error wraps ErrTampered and names the first offending line.
+func Verify(r io.Reader, signer common.Address) (Report, error) {
+	report := Report{Kinds: make(map[string]int), LastHash: GenesisHash}
+	signers := make(map[string]bool)
+	scanner := newScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		tampered := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrTampered, line, fmt.Sprintf(format, args...))
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return report, tampered("%s", err)
+		}
+		if e.Seq != report.LastSeq+1 {
+			return report, tampered("sequence %d follows %d", e.Seq, report.LastSeq)
+		}
+		if e.PrevHash != report.LastHash {
+			return report, tampered("previous hash %s, want %s", e.PrevHash, report.LastHash)
+		}
+		digest, err := e.digest()
+		if err != nil {
+			return report, tampered("%s", err)
+		}
+		if e.Hash != hex.EncodeToString(digest) {
+			return report, tampered("hash %s does not match the content", e.Hash)
+		}
+		if err := verifySignature(e, digest, signer); err != nil {
+			return report, tampered("%s", err)
+		}
+
+		report.Entries++
+		report.Kinds[e.Kind]++
+		if e.Signature != "" {
+			report.Signed++
+			if !signers[e.Signer] {
+				signers[e.Signer] = true
+				report.Signers = append(report.Signers, e.Signer)
+			}
+		}
+		report.LastSeq, report.LastHash = e.Seq, e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func verifySignature(e Entry, digest []byte, signer common.Address) error {
+	if e.Signature == "" {
+		if e.Signer != "" || signer != (common.Address{}) {
+			return fmt.Errorf("entry %d is not signed", e.Seq)
+		}
+		return nil
+	}
+	sig, err := hex.DecodeString(e.Signature)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	pub, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	recovered := crypto.PubkeyToAddress(*pub)
+	if recovered != common.HexToAddress(e.Signer) {
+		return fmt.Errorf("signed by %s, not %s", recovered.Hex(), e.Signer)
+	}
+	if signer != (common.Address{}) && recovered != signer {
+		return fmt.Errorf("signed by %s, want %s", recovered.Hex(), signer.Hex())
+	}
+	return nil
+}
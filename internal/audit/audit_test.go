@@ -0,0 +1,148 @@
+package audit_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aura-nw/lotus-operator/internal/audit"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLog writes n entries to a new log, reopening it halfway, and returns
+// its lines.
+func writeLog(t *testing.T, n int, sign bool) []string {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	if !sign {
+		key = nil
+	}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < n; i++ {
+		l, err := audit.Open(path, key)
+		require.NoError(t, err)
+		seq, _ := l.Head()
+		require.Equal(t, uint64(i), seq)
+		require.NoError(t, l.Append(audit.KindVerdict, map[string]any{"id": i, "verdict": "valid"}))
+		require.NoError(t, l.Close())
+	}
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(raw)), "\n")
+}
+
+func verify(lines []string, signer common.Address) (audit.Report, error) {
+	return audit.Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), signer)
+}
+
+func TestVerify(t *testing.T) {
+	lines := writeLog(t, 4, true)
+	report, err := verify(lines, common.Address{})
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Entries)
+	require.Equal(t, 4, report.Signed)
+	require.Len(t, report.Signers, 1)
+	require.Equal(t, 4, report.Kinds[audit.KindVerdict])
+	require.Equal(t, uint64(4), report.LastSeq)
+
+	var last audit.Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &last))
+	require.Equal(t, last.Hash, report.LastHash)
+
+	_, err = verify(lines, common.HexToAddress(report.Signers[0]))
+	require.NoError(t, err)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		sign   bool
+		tamper func(lines []string) []string
+		signer common.Address
+	}{
+		{
+			name: "data edited",
+			sign: true,
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"verdict":"valid"`, `"verdict":"invalid"`, 1)
+				return lines
+			},
+		},
+		{
+			name:   "entry removed",
+			tamper: func(lines []string) []string { return append(lines[:1], lines[2:]...) },
+		},
+		{
+			name: "entries swapped",
+			tamper: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+		},
+		{
+			name: "entry rehashed",
+			tamper: func(lines []string) []string {
+				// A consistent hash does not help once the next entry
+				// points at the original one
+				var e audit.Entry
+				if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+					panic(err)
+				}
+				e.Data = json.RawMessage(`{"id":1,"verdict":"invalid"}`)
+				lines[1] = string(rehash(e))
+				return lines
+			},
+		},
+		{
+			name: "signature removed",
+			sign: true,
+			tamper: func(lines []string) []string {
+				var e audit.Entry
+				if err := json.Unmarshal([]byte(lines[2]), &e); err != nil {
+					panic(err)
+				}
+				e.Signature = ""
+				bz, _ := json.Marshal(e)
+				lines[2] = string(bz)
+				return lines
+			},
+		},
+		{
+			name:   "unsigned when a signer is required",
+			tamper: func(lines []string) []string { return lines },
+			signer: crypto.PubkeyToAddress(other.PublicKey),
+		},
+		{
+			name:   "signed by another key",
+			sign:   true,
+			tamper: func(lines []string) []string { return lines },
+			signer: crypto.PubkeyToAddress(other.PublicKey),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.tamper(writeLog(t, 4, tt.sign))
+			_, err := verify(lines, tt.signer)
+			require.ErrorIs(t, err, audit.ErrTampered)
+		})
+	}
+}
+
+// rehash returns e encoded with the hash of its content, as a forger would.
+func rehash(e audit.Entry) []byte {
+	e.Hash, e.Signature = "", ""
+	bz, _ := json.Marshal(e)
+	sum := sha256.Sum256(bz)
+	e.Hash = hex.EncodeToString(sum[:])
+	bz, _ = json.Marshal(e)
+	return bz
+}
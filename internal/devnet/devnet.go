@@ -0,0 +1,365 @@
+// Package devnet runs a local bridge in-process: a regtest bitcoind, a gateway
+// contract and N operators sharing a threshold multisig wallet, to drive
+// deposits and withdrawals end to end.
+package devnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	defaultOperators        = 3
+	defaultMinConfirmations = 2
+	pollInterval            = 100 * time.Millisecond
+)
+
+// ErrNoFunds is returned by Withdraw when no deposit can pay the withdrawal.
+var ErrNoFunds = errors.New("devnet: multisig has no deposit to spend")
+
+var params = &chaincfg.RegressionNetParams
+
+// Options configures a devnet.
+type Options struct {
+	// Operators is the number of operators, 3 by default.
+	Operators int
+	// Threshold is the number of votes and signatures the gateway requires,
+	// a majority of the operators by default.
+	Threshold int
+	// HttpPort is the port of the first operator server, the others use the
+	// next ports. Servers listen on random ports when zero.
+	HttpPort int
+	// Logger receives the logs of the operators, tagged by operator index.
+	Logger *slog.Logger
+}
+
+// Devnet is a running local bridge.
+type Devnet struct {
+	Bitcoind  *bitcointest.Bitcoind
+	Gateway   *evmtest.Gateway
+	Operators []*operator.Operator
+
+	threshold    int
+	pubKeys      []*btcutil.AddressPubKey
+	multisig     btcutil.Address
+	redeemScript []byte
+
+	mu       sync.Mutex
+	deposits []deposit
+	nextTx   byte
+}
+
+// deposit is an unspent output paying the multisig wallet.
+type deposit struct {
+	outPoint wire.OutPoint
+	amount   int64
+}
+
+// New creates a devnet. Operators start with Start.
+func New(ctx context.Context, opts Options) (*Devnet, error) {
+	if opts.Operators <= 0 {
+		opts.Operators = defaultOperators
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = opts.Operators/2 + 1
+	}
+	if opts.Threshold > opts.Operators {
+		return nil, fmt.Errorf("threshold %d above %d operators", opts.Threshold, opts.Operators)
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	btcKeys := make([]*btcec.PrivateKey, opts.Operators)
+	pubKeys := make([]*btcutil.AddressPubKey, opts.Operators)
+	evmKeys := make([]string, opts.Operators)
+	validators := make([]common.Address, opts.Operators)
+	for i := range btcKeys {
+		btcKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		pubKey, err := btcutil.NewAddressPubKey(btcKey.PubKey().SerializeCompressed(), params)
+		if err != nil {
+			return nil, err
+		}
+		evmKey, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		btcKeys[i], pubKeys[i] = btcKey, pubKey
+		evmKeys[i] = hex.EncodeToString(crypto.FromECDSA(evmKey))
+		validators[i] = crypto.PubkeyToAddress(evmKey.PublicKey)
+	}
+
+	redeemScript, err := txscript.MultiSigScript(pubKeys, opts.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	scriptHash := chainhash.HashB(redeemScript)
+	multisig, err := btcutil.NewAddressWitnessScriptHash(scriptHash, params)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Devnet{
+		Bitcoind:     bitcointest.NewBitcoind(params),
+		Gateway:      evmtest.NewGateway(opts.Threshold, validators...),
+		threshold:    opts.Threshold,
+		pubKeys:      pubKeys,
+		multisig:     multisig,
+		redeemScript: redeemScript,
+	}
+	for i := range btcKeys {
+		wif, err := btcutil.NewWIF(btcKeys[i], params, true)
+		if err != nil {
+			d.Bitcoind.Close()
+			return nil, err
+		}
+		httpPort := "0"
+		if opts.HttpPort > 0 {
+			httpPort = strconv.Itoa(opts.HttpPort + i)
+		}
+		cfg := &config.Config{
+			Server: config.ServerInfo{HttpPort: httpPort},
+			Evm: config.EvmInfo{
+				QueryInterval: 1,
+				PrivateKey:    evmKeys[i],
+			},
+			Bitcoin: config.BitcoinInfo{
+				Network:          config.NetworkRegtest,
+				MultisigAddress:  multisig.EncodeAddress(),
+				RedeemScript:     hex.EncodeToString(redeemScript),
+				PrivateKey:       wif.String(),
+				MinConfirmations: defaultMinConfirmations,
+			},
+		}
+		d.Bitcoind.Configure(&cfg.Bitcoin)
+
+		logger := opts.Logger.With("operator", i)
+		btcVerifier, err := bitcoin.NewVerifier(logger.With("component", "bitcoin"), cfg.Bitcoin)
+		if err != nil {
+			d.Bitcoind.Close()
+			return nil, err
+		}
+		op, err := operator.NewOperatorWithVerifiers(ctx, cfg, logger, d.Gateway.Verifier(validators[i]), btcVerifier)
+		if err != nil {
+			d.Bitcoind.Close()
+			return nil, err
+		}
+		d.Operators = append(d.Operators, op)
+	}
+	return d, nil
+}
+
+// MultisigAddress returns the address of the wallet the operators share.
+func (d *Devnet) MultisigAddress() string {
+	return d.multisig.EncodeAddress()
+}
+
+// Threshold returns the number of votes and signatures the gateway requires.
+func (d *Devnet) Threshold() int {
+	return d.threshold
+}
+
+// Start starts every operator.
+func (d *Devnet) Start() {
+	for _, op := range d.Operators {
+		op.Start()
+	}
+}
+
+// Stop stops every operator and the bitcoind.
+func (d *Devnet) Stop(ctx context.Context) error {
+	var errs []error
+	for _, op := range d.Operators {
+		errs = append(errs, op.Stop(ctx))
+	}
+	d.Bitcoind.Close()
+	return errors.Join(errs...)
+}
+
+// Deposit pays amount sats to the multisig wallet in a block confirmed enough
+// for the operators, and creates the matching incoming invoice for
+// recipient. It returns the invoice id.
+func (d *Devnet) Deposit(amount int64, recipient common.Address) (uint64, error) {
+	pkScript, err := txscript.PayToAddrScript(d.multisig)
+	if err != nil {
+		return 0, err
+	}
+	tx := d.newTx(nil)
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	d.Bitcoind.AddTransaction(tx, d.Bitcoind.BlockCount()+1)
+	d.Bitcoind.Mine(defaultMinConfirmations)
+
+	d.mu.Lock()
+	d.deposits = append(d.deposits, deposit{outPoint: wire.OutPoint{Hash: tx.TxHash(), Index: 0}, amount: amount})
+	d.mu.Unlock()
+
+	utxo := bitcoin.UtxoDef{TxHash: tx.TxHash().String(), Amount: uint64(amount), Receiver: recipient.Hex()}
+	return d.Gateway.AddIncomingInvoice(utxo.String(), big.NewInt(amount), recipient), nil
+}
+
+// Withdraw creates an outgoing invoice paying amount sats to the bitcoin
+// address, and submits a tx spending a deposit to pay it, with the change
+// back to the multisig wallet. It returns the outgoing tx id.
+func (d *Devnet) Withdraw(from common.Address, amount int64, address string) (uint64, error) {
+	addr, err := btcutil.DecodeAddress(address, params)
+	if err != nil {
+		return 0, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return 0, err
+	}
+	changeScript, err := txscript.PayToAddrScript(d.multisig)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	var funds *deposit
+	for i := range d.deposits {
+		if d.deposits[i].amount >= amount {
+			spent := d.deposits[i]
+			funds = &spent
+			d.deposits = append(d.deposits[:i], d.deposits[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+	if funds == nil {
+		return 0, fmt.Errorf("%w of %d sats", ErrNoFunds, amount)
+	}
+
+	tx := d.newTx(&funds.outPoint)
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	if change := funds.amount - amount; change > 0 {
+		tx.AddTxOut(wire.NewTxOut(change, changeScript))
+	}
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		return 0, err
+	}
+
+	invoiceId := d.Gateway.AddOutgoingInvoice(from, big.NewInt(amount), address)
+	return d.Gateway.AddOutgoingTx(hex.EncodeToString(raw.Bytes()), invoiceId), nil
+}
+
+// ValidSignatures returns how many signatures on the outgoing tx id are valid
+// signatures of a multisig key over its first input.
+func (d *Devnet) ValidSignatures(id uint64) (int, error) {
+	outgoing := d.Gateway.OutgoingTx(id)
+	raw, err := hex.DecodeString(outgoing.TxContent)
+	if err != nil {
+		return 0, err
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return 0, err
+	}
+	sigHash, err := txscript.CalcSignatureHash(d.redeemScript, txscript.SigHashAll, &tx, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	valid := 0
+	for _, signature := range outgoing.Signatures {
+		sigScript, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+		if d.verifySignature(sigScript, sigHash) {
+			valid++
+		}
+	}
+	return valid, nil
+}
+
+// verifySignature reports whether sigScript, as built by bitcoin.Verifier
+// Sign, pushes a signature of sigHash by one of the multisig keys.
+func (d *Devnet) verifySignature(sigScript, sigHash []byte) bool {
+	pushes, err := txscript.PushedData(sigScript)
+	if err != nil || len(pushes) != 2 || len(pushes[0]) == 0 {
+		return false
+	}
+	der, pubKeyBytes := pushes[0][:len(pushes[0])-1], pushes[1]
+	sig, err := ecdsa.ParseDERSignature(der)
+	if err != nil {
+		return false
+	}
+	for _, pubKey := range d.pubKeys {
+		if bytes.Equal(pubKey.ScriptAddress(), pubKeyBytes) {
+			return sig.Verify(sigHash, pubKey.PubKey())
+		}
+	}
+	return false
+}
+
+// newTx returns a tx spending prev, or a fresh coinbase-like outpoint.
+func (d *Devnet) newTx(prev *wire.OutPoint) *wire.MsgTx {
+	if prev == nil {
+		d.mu.Lock()
+		d.nextTx++
+		prev = &wire.OutPoint{Hash: chainhash.Hash{d.nextTx}}
+		d.mu.Unlock()
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(prev, nil, nil))
+	return tx
+}
+
+// WaitIncoming waits until the incoming invoice id leaves the Pending status
+// and returns its status.
+func (d *Devnet) WaitIncoming(ctx context.Context, id uint64) (evm.InvoiceStatus, error) {
+	return wait(ctx, func() evm.InvoiceStatus {
+		return evm.InvoiceStatus(d.Gateway.IncomingInvoice(id).Status)
+	})
+}
+
+// WaitOutgoing waits until the outgoing tx id leaves the Pending status and
+// returns its status.
+func (d *Devnet) WaitOutgoing(ctx context.Context, id uint64) (evm.InvoiceStatus, error) {
+	return wait(ctx, func() evm.InvoiceStatus {
+		return evm.InvoiceStatus(d.Gateway.OutgoingTx(id).Status)
+	})
+}
+
+func wait(ctx context.Context, status func() evm.InvoiceStatus) (evm.InvoiceStatus, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if s := status(); s != evm.Pending {
+			return s, nil
+		}
+		select {
+		case <-ctx.Done():
+			return evm.Pending, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package devnet_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/internal/devnet"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+const withdrawalAddr = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+
+var recipient = common.HexToAddress("0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A")
+
+func TestDevnet(t *testing.T) {
+	d, err := devnet.New(context.Background(), devnet.Options{Operators: 3, Threshold: 2, Logger: slog.Default()})
+	require.NoError(t, err)
+	d.Start()
+	defer d.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	deposit, err := d.Deposit(10000, recipient)
+	require.NoError(t, err)
+	status, err := d.WaitIncoming(ctx, deposit)
+	require.NoError(t, err)
+	require.Equal(t, evm.Minted, status)
+
+	_, err = d.Withdraw(recipient, 20000, withdrawalAddr)
+	require.ErrorIs(t, err, devnet.ErrNoFunds)
+
+	withdrawal, err := d.Withdraw(recipient, 4000, withdrawalAddr)
+	require.NoError(t, err)
+	status, err = d.WaitOutgoing(ctx, withdrawal)
+	require.NoError(t, err)
+	require.Equal(t, evm.Paid, status)
+
+	signatures, err := d.ValidSignatures(withdrawal)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, signatures, d.Threshold())
+}
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "lotus_operator"
+
+	ChainEvm     = "evm"
+	ChainBitcoin = "bitcoin"
+)
+
+// Registry holds every operator metric, it is served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	InvoicesSeen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "invoices_seen_total",
+		Help:      "Number of invoices picked up for verification.",
+	}, []string{"direction"})
+
+	Verdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verdicts_total",
+		Help:      "Number of verification verdicts by result and reason.",
+	}, []string{"direction", "result", "reason"})
+
+	VotesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "votes_sent_total",
+		Help:      "Number of vote transactions mined successfully.",
+	}, []string{"direction"})
+
+	VotesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "votes_failed_total",
+		Help:      "Number of vote transactions that failed to be sent or mined.",
+	}, []string{"direction"})
+
+	GasUsed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evm_gas_used_total",
+		Help:      "Gas used by mined operator transactions.",
+	})
+
+	FeesPaid = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evm_fees_paid_wei_total",
+		Help:      "Fees in wei paid by mined operator transactions.",
+	})
+
+	WaitMinedLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "evm_wait_mined_seconds",
+		Help:      "Time between sending an operator transaction and its receipt.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	})
+
+	RPCLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of bitcoind and EVM RPC calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chain", "method"})
+
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Number of failed bitcoind and EVM RPC calls.",
+	}, []string{"chain", "method"})
+
+	RPCFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_failovers_total",
+		Help:      "Number of times a call moved to another bitcoind or EVM endpoint.",
+	}, []string{"chain"})
+
+	QuorumDisagreements = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evm_quorum_disagreements_total",
+		Help:      "Number of quorum reads where EVM endpoints returned different answers.",
+	}, []string{"method"})
+
+	LoopLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "loop_lag",
+		Help:      "Invoices on the gateway not yet processed by this operator.",
+	}, []string{"direction"})
+
+	SignerOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signer_operations_total",
+		Help:      "Number of signing operations by result.",
+	}, []string{"chain", "result"})
+
+	EvmBalance = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "evm_balance_wei",
+		Help:      "Balance of the operator EVM account in wei.",
+	})
+
+	EvmVotesRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "evm_votes_remaining",
+		Help:      "Estimated number of votes the operator EVM balance can pay for.",
+	})
+
+	VotesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "votes_skipped_total",
+		Help:      "Number of votes not sent because the balance cannot cover them.",
+	}, []string{"direction"})
+
+	ShadowDisagreements = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_disagreements_total",
+		Help:      "Number of shadow mode verdicts disagreeing with the votes on chain.",
+	}, []string{"direction"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		InvoicesSeen,
+		Verdicts,
+		VotesSent,
+		VotesFailed,
+		GasUsed,
+		FeesPaid,
+		WaitMinedLatency,
+		RPCLatency,
+		RPCErrors,
+		RPCFailovers,
+		QuorumDisagreements,
+		LoopLag,
+		SignerOps,
+		EvmBalance,
+		EvmVotesRemaining,
+		VotesSkipped,
+		ShadowDisagreements,
+	)
+}
+
+// Handler returns the http handler exposing Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRPC records latency and error of a RPC call started at start.
+// It is meant to be deferred with a pointer to the named error result.
+func ObserveRPC(chain, method string, start time.Time, err *error) {
+	RPCLatency.WithLabelValues(chain, method).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		RPCErrors.WithLabelValues(chain, method).Inc()
+	}
+}
+
+// ObserveVote counts a vote transaction outcome.
+func ObserveVote(direction string, err error) {
+	if err != nil {
+		VotesFailed.WithLabelValues(direction).Inc()
+		return
+	}
+	VotesSent.WithLabelValues(direction).Inc()
+}
+
+// SetLoopLag records how far the operator cursor is behind the gateway count.
+func SetLoopLag(direction string, count, cursor uint64) {
+	lag := 0.0
+	if count+1 > cursor {
+		lag = float64(count + 1 - cursor)
+	}
+	LoopLag.WithLabelValues(direction).Set(lag)
+}
@@ -0,0 +1,29 @@
+package metrics_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveRPC(t *testing.T) {
+	var err error
+	metrics.ObserveRPC(metrics.ChainEvm, "test_ok", time.Now(), &err)
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.RPCErrors.WithLabelValues(metrics.ChainEvm, "test_ok")))
+
+	err = errors.New("boom")
+	metrics.ObserveRPC(metrics.ChainEvm, "test_err", time.Now(), &err)
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.RPCErrors.WithLabelValues(metrics.ChainEvm, "test_err")))
+}
+
+func TestSetLoopLag(t *testing.T) {
+	metrics.SetLoopLag("incoming", 10, 8)
+	require.Equal(t, 3.0, testutil.ToFloat64(metrics.LoopLag.WithLabelValues("incoming")))
+
+	metrics.SetLoopLag("incoming", 10, 11)
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.LoopLag.WithLabelValues("incoming")))
+}
@@ -0,0 +1,127 @@
+package operator
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aura-nw/lotus-operator/internal/audit"
+	"github.com/aura-nw/lotus-operator/internal/operator/types"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// auditVerdict is the audit log entry of an invoice or tx evaluated.
+type auditVerdict struct {
+	InvoiceRecord
+	Shadow           bool  `json:"shadow,omitempty"`
+	MinConfirmations int64 `json:"min_confirmations"`
+}
+
+// auditSignature is the audit log entry of a bitcoin tx signed for an
+// outgoing tx.
+type auditSignature struct {
+	Id            uint64         `json:"id"`
+	CorrelationId string         `json:"correlation_id"`
+	BtcTxId       string         `json:"btc_txid"`
+	Input         string         `json:"input"`
+	SigHash       string         `json:"sighash,omitempty"`
+	Outputs       []auditPayment `json:"outputs"`
+}
+
+type auditPayment struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+// auditAppend writes an entry to the audit log, if any.
+func (op *Operator) auditAppend(kind string, data any) error {
+	if op.audit == nil {
+		return nil
+	}
+	if err := op.audit.Append(kind, data); err != nil {
+		op.logger.Error("write audit log error", "kind", kind, "err", err)
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// auditVerdict records the verdict on record. It is written after the
+// vote, if any, so a failed write is logged and does not undo the vote.
+func (op *Operator) auditVerdict(record InvoiceRecord) {
+	if op.audit == nil {
+		return
+	}
+	_ = op.auditAppend(audit.KindVerdict, auditVerdict{
+		InvoiceRecord:    record,
+		Shadow:           op.shadow != nil,
+		MinConfirmations: op.Config().Bitcoin.MinConfirmations,
+	})
+}
+
+// auditSignature records the sighash of tx signed to pay outputs for the
+// outgoing tx of trace. The signature must not be used when it fails.
+func (op *Operator) auditSignature(trace invoiceTrace, tx *wire.MsgTx, outputs []types.Utxo) error {
+	if op.audit == nil {
+		return nil
+	}
+	entry := auditSignature{
+		Id:            trace.id,
+		CorrelationId: trace.correlationId,
+		BtcTxId:       tx.TxHash().String(),
+		Outputs:       make([]auditPayment, 0, len(outputs)),
+	}
+	if len(tx.TxIn) > 0 {
+		entry.Input = tx.TxIn[0].PreviousOutPoint.String()
+	}
+	if v, ok := op.btcVerifier.(interface {
+		SigHash(tx *wire.MsgTx) ([]byte, error)
+	}); ok {
+		if sigHash, err := v.SigHash(tx); err == nil {
+			entry.SigHash = hex.EncodeToString(sigHash)
+		} else {
+			trace.logger.Error("compute sighash error", "err", err)
+		}
+	}
+	for _, output := range outputs {
+		entry.Outputs = append(entry.Outputs, auditPayment{Address: output.Address, Amount: output.Amount})
+	}
+	return op.auditAppend(audit.KindSignature, entry)
+}
+
+// openAudit opens the audit log configured in path.
+func (op *Operator) openAudit(path string, sign bool, privateKey string) error {
+	key, err := auditKey(sign, privateKey)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.Open(path, key)
+	if err != nil {
+		return err
+	}
+	seq, hash := auditLog.Head()
+	op.logger.Info("audit log opened", "path", path, "seq", seq, "last_hash", hash, "signed", key != nil)
+	op.audit = auditLog
+	return nil
+}
+
+// closeAudit closes the audit log, if any.
+func (op *Operator) closeAudit() {
+	if op.audit == nil {
+		return
+	}
+	if err := op.audit.Close(); err != nil {
+		op.logger.Error("close audit log error", "err", err)
+	}
+}
+
+func auditKey(sign bool, privateKey string) (*ecdsa.PrivateKey, error) {
+	if !sign {
+		return nil, nil
+	}
+	key, err := crypto.HexToECDSA(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("audit signing key: %w", err)
+	}
+	return key, nil
+}
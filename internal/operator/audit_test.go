@@ -0,0 +1,183 @@
+package operator
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/audit"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// auditedOutgoing returns an operator with an audit log at path, voting on
+// an outgoing tx that pays its invoice.
+func auditedOutgoing(t *testing.T, path string, key *ecdsa.PrivateKey) (*Operator, *evmtest.MockVerifier) {
+	tx := contracts.IGatewayOutgoingTxInfo{
+		TxId:       big.NewInt(1),
+		InvoiceIds: []*big.Int{big.NewInt(1)},
+		TxContent:  withdrawalTx(t, 500),
+		Status:     uint8(evm.Pending),
+	}
+	evmVerifier := &evmtest.MockVerifier{
+		GetOutgoingTxCountFn:             func() (*big.Int, error) { return big.NewInt(1), nil },
+		GetOutgoingTxFn:                  func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil },
+		GetNextIdVerifyOutgoingInvoiceFn: func(common.Address) (*big.Int, error) { return big.NewInt(1), nil },
+		GetOutgoingInvoiceFn: func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+			return contracts.IGatewayOutgoingInvoiceResponse{
+				InvoiceId: big.NewInt(1),
+				Amount:    big.NewInt(500),
+				Recipient: withdrawalAddr,
+				Status:    uint8(evm.Pending),
+			}, nil
+		},
+		VerifyOutgoingTxFn: func(uint64, bool, string) (common.Hash, error) { return common.Hash{1}, nil },
+	}
+	btcVerifier := &bitcointest.MockVerifier{
+		ConvertToAddressFn: regtestAddress,
+		SignFn:             func(*wire.MsgTx) ([]byte, error) { return []byte{0xab}, nil },
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	require.NoError(t, op.openAudit(path, true, common.Bytes2Hex(crypto.FromECDSA(key))))
+	return op, evmVerifier
+}
+
+// readAudit verifies the audit log at path was signed by key and returns
+// its entries.
+func readAudit(t *testing.T, path string, key *ecdsa.PrivateKey) []audit.Entry {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = audit.Verify(f, crypto.PubkeyToAddress(key.PublicKey))
+	require.NoError(t, err)
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditOutgoing(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	op, _ := auditedOutgoing(t, path, key)
+	defer op.audit.Close()
+
+	op.processOutgoing()
+
+	entries := readAudit(t, path, key)
+	require.Len(t, entries, 2)
+
+	// The signature comes first, the verdict carries the vote
+	require.Equal(t, audit.KindSignature, entries[0].Kind)
+	var signature auditSignature
+	require.NoError(t, json.Unmarshal(entries[0].Data, &signature))
+	require.Equal(t, []auditPayment{{Address: withdrawalAddr, Amount: 500}}, signature.Outputs)
+	require.NotEmpty(t, signature.BtcTxId)
+	require.Equal(t, uint64(1), signature.Id)
+
+	require.Equal(t, audit.KindVerdict, entries[1].Kind)
+	var verdict auditVerdict
+	require.NoError(t, json.Unmarshal(entries[1].Data, &verdict))
+	require.Equal(t, verdictValid, verdict.Verdict)
+	require.Equal(t, common.Hash{1}.Hex(), verdict.VoteTxHash)
+	require.NotEmpty(t, verdict.CorrelationId)
+	require.Equal(t, verdict.CorrelationId, signature.CorrelationId)
+}
+
+func TestAuditOutgoingFailsClosed(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	op, evmVerifier := auditedOutgoing(t, filepath.Join(t.TempDir(), "audit.jsonl"), key)
+	require.NoError(t, op.audit.Close())
+
+	op.processOutgoing()
+
+	require.Zero(t, evmVerifier.Calls("VerifyOutgoingTx"))
+	records := op.OutgoingInvoices()
+	require.Len(t, records, 1)
+	require.Equal(t, verdictError, records[0].Verdict)
+	require.Contains(t, records[0].Error, "write audit log")
+}
+
+func TestAuditIncoming(t *testing.T) {
+	evmVerifier := &evmtest.MockVerifier{
+		VerifyIncomingInvoiceFn: func(uint64, string, *big.Int, common.Address, bool) (common.Hash, error) {
+			return common.Hash{1}, nil
+		},
+	}
+	gatewayWith(evmVerifier, 1, incomingInvoice(1, evm.Pending, false, false))
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(string, uint64, string) (bool, int64, error) { return true, 7, nil },
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, op.openAudit(path, true, common.Bytes2Hex(crypto.FromECDSA(key))))
+	defer op.audit.Close()
+
+	require.NoError(t, op.processIncoming())
+
+	entries := readAudit(t, path, key)
+	require.Len(t, entries, 1)
+	var verdict auditVerdict
+	require.NoError(t, json.Unmarshal(entries[0].Data, &verdict))
+	require.Equal(t, verdictValid, verdict.Verdict)
+	require.Equal(t, int64(7), verdict.DepositConfirmations)
+	require.Zero(t, btcVerifier.Calls("GetBlockCount"))
+}
+
+func TestAuditIncomingRetries(t *testing.T) {
+	evmVerifier := &evmtest.MockVerifier{
+		VerifyIncomingInvoiceFn: func(uint64, string, *big.Int, common.Address, bool) (common.Hash, error) {
+			return common.Hash{1}, nil
+		},
+	}
+	gatewayWith(evmVerifier, 1, incomingInvoice(1, evm.Pending, false, false))
+	depositErr := errRPC
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(string, uint64, string) (bool, int64, error) { return depositErr == nil, 6, depositErr },
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, op.openAudit(path, true, common.Bytes2Hex(crypto.FromECDSA(key))))
+	defer op.audit.Close()
+
+	// A failing lookup is audited once, however many ticks retry it
+	for i := 0; i < 3; i++ {
+		require.NoError(t, op.processIncoming())
+	}
+	require.Len(t, readAudit(t, path, key), 1)
+
+	depositErr = nil
+	require.NoError(t, op.processIncoming())
+	entries := readAudit(t, path, key)
+	require.Len(t, entries, 2)
+	var verdicts []string
+	for _, entry := range entries {
+		var verdict auditVerdict
+		require.NoError(t, json.Unmarshal(entry.Data, &verdict))
+		verdicts = append(verdicts, verdict.Verdict)
+	}
+	require.Equal(t, []string{verdictError, verdictValid}, verdicts)
+}
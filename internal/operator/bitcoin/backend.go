@@ -0,0 +1,173 @@
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrTxNotFound is returned by a ChainBackend that does not know a transaction.
+var ErrTxNotFound = errors.New("transaction not found")
+
+// ChainBackend is a source of bitcoin chain data deposits are verified against.
+type ChainBackend interface {
+	// Name identifies the backend in logs and errors.
+	Name() string
+	GetBlockCount(ctx context.Context) (int64, error)
+	GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error)
+	GetTransaction(ctx context.Context, txHash *chainhash.Hash) (*Transaction, error)
+}
+
+// Transaction is a transaction as seen by a ChainBackend.
+type Transaction struct {
+	TxHash string
+	// Confirmations is 0 while the transaction is in the mempool
+	Confirmations int64
+	Outputs       []TxOutput
+}
+
+// TxOutput is an output of a Transaction.
+type TxOutput struct {
+	Value    int64
+	PkScript []byte
+}
+
+// newChainBackends builds the backends listed in info.Backends, bitcoind
+// when none is listed. rpc is nil unless bitcoind is one of them. A non-nil
+// transport carries the http requests of every backend; electrum speaks raw
+// TCP and cannot be used with one.
+func newChainBackends(logger *slog.Logger, info config.BitcoinInfo, transport http.RoundTripper) ([]ChainBackend, *rpcPool, error) {
+	names := info.Backends
+	if len(names) == 0 {
+		names = []string{config.BackendBitcoind}
+	}
+
+	var backends []ChainBackend
+	var rpc *rpcPool
+	for _, name := range names {
+		switch name {
+		case config.BackendBitcoind:
+			pool, err := newRPCPool(logger, info, transport)
+			if err != nil {
+				return nil, nil, err
+			}
+			rpc = pool
+			backends = append(backends, &bitcoindBackend{rpc: pool})
+		case config.BackendEsplora:
+			esplora := NewEsploraBackend(info.EsploraUrl, callTimeout(info))
+			if transport != nil {
+				esplora.client.Transport = transport
+			}
+			backends = append(backends, esplora)
+		case config.BackendElectrum:
+			if transport != nil {
+				return nil, nil, fmt.Errorf("bitcoin backend %q cannot use an rpc transport", name)
+			}
+			backends = append(backends, NewElectrumBackend(info.ElectrumHost, info.ElectrumTLS, callTimeout(info)))
+		default:
+			return nil, nil, fmt.Errorf("unknown bitcoin backend %q", name)
+		}
+	}
+	return backends, rpc, nil
+}
+
+func callTimeout(info config.BitcoinInfo) time.Duration {
+	if info.CallTimeout == 0 {
+		return defaultCallTimeout * time.Second
+	}
+	return time.Duration(info.CallTimeout) * time.Second
+}
+
+// bitcoindBackend implements ChainBackend with the bitcoind JSON-RPC. It needs
+// txindex to look up transactions.
+type bitcoindBackend struct {
+	rpc *rpcPool
+}
+
+// Name implements ChainBackend.
+func (b *bitcoindBackend) Name() string {
+	return config.BackendBitcoind
+}
+
+// GetBlockCount implements ChainBackend.
+func (b *bitcoindBackend) GetBlockCount(ctx context.Context) (height int64, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "getblockcount", time.Now(), &err)
+	return rpcCall(ctx, b.rpc, "getblockcount", (*rpcclient.Client).GetBlockCount)
+}
+
+// GetBlockHash implements ChainBackend.
+func (b *bitcoindBackend) GetBlockHash(ctx context.Context, height int64) (hash *chainhash.Hash, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "getblockhash", time.Now(), &err)
+	return rpcCall(ctx, b.rpc, "getblockhash", func(c *rpcclient.Client) (*chainhash.Hash, error) {
+		return c.GetBlockHash(height)
+	})
+}
+
+// GetTransaction implements ChainBackend. The outputs are decoded from the
+// raw transaction, checked to hash to txHash. With backup hosts, a
+// confirmed transaction is cross-checked on a second node, see crossCheckTx.
+func (b *bitcoindBackend) GetTransaction(ctx context.Context, txHash *chainhash.Hash) (*Transaction, error) {
+	reachable, err := b.rpc.checkBestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := b.getRawTransactionVerbose(ctx, txHash)
+	if err != nil {
+		var rpcErr *btcjson.RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+			return nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+		}
+		return nil, err
+	}
+
+	msgTx, err := decodeRawTx(raw, txHash)
+	if err != nil {
+		return nil, err
+	}
+	tx := &Transaction{TxHash: txHash.String(), Confirmations: int64(raw.Confirmations)}
+	if tx.Confirmations > 0 && len(reachable) > 1 {
+		if tx.Confirmations, err = b.rpc.crossCheckTx(ctx, reachable, txHash, raw.BlockHash, tx.Confirmations); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range msgTx.TxOut {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: out.Value, PkScript: out.PkScript})
+	}
+	return tx, nil
+}
+
+// decodeRawTx decodes the hex of raw and checks that it is the transaction
+// txHash, rather than trusting the outputs a node reports.
+func decodeRawTx(raw *btcjson.TxRawResult, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	bz, err := hex.DecodeString(raw.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("decode tx %s: %w", txHash, err)
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(bz)); err != nil {
+		return nil, fmt.Errorf("decode tx %s: %w", txHash, err)
+	}
+	if got := msgTx.TxHash(); !got.IsEqual(txHash) {
+		return nil, fmt.Errorf("bitcoind returned tx %s for %s", got, txHash)
+	}
+	return &msgTx, nil
+}
+
+func (b *bitcoindBackend) getRawTransactionVerbose(ctx context.Context, txHash *chainhash.Hash) (tx *btcjson.TxRawResult, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "getrawtransaction", time.Now(), &err)
+	return rpcCall(ctx, b.rpc, "getrawtransaction", func(c *rpcclient.Client) (*btcjson.TxRawResult, error) {
+		return c.GetRawTransactionVerbose(txHash)
+	})
+}
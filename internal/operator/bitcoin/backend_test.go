@@ -0,0 +1,273 @@
+package bitcoin_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+const recipient = "0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A"
+
+func regtestInfo(t *testing.T) config.BitcoinInfo {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	wif, err := btcutil.NewWIF(key, &chaincfg.RegressionNetParams, true)
+	require.NoError(t, err)
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	return config.BitcoinInfo{
+		Network:          config.NetworkRegtest,
+		MultisigAddress:  addr.EncodeAddress(),
+		RedeemScript:     "51",
+		PrivateKey:       wif.String(),
+		MinConfirmations: 2,
+	}
+}
+
+func depositTx(t *testing.T, info config.BitcoinInfo, amount int64) *wire.MsgTx {
+	addr, err := btcutil.DecodeAddress(info.MultisigAddress, &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	memo, err := txscript.NullDataScript([]byte("lotus"))
+	require.NoError(t, err)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(0, memo))
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	return tx
+}
+
+func utxoOf(tx *wire.MsgTx, amount uint64) string {
+	utxo := bitcoin.UtxoDef{TxHash: tx.TxHash().String(), Amount: amount, Receiver: recipient}
+	return utxo.String()
+}
+
+func TestVerifyBtcDeposit(t *testing.T) {
+	info := regtestInfo(t)
+	backend := bitcoin.NewMemoryBackend("memory", &chaincfg.RegressionNetParams)
+	verifier, err := bitcoin.NewVerifierWithBackends(slog.Default(), info, backend)
+	require.NoError(t, err)
+
+	tx := depositTx(t, info, 1000)
+	_, _, err = verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.ErrorIs(t, err, bitcoin.ErrTxNotFound)
+
+	backend.AddTransaction(tx, 10)
+	_, _, err = verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.ErrorIs(t, err, bitcoin.ErrNotConfirmed)
+
+	backend.Mine(1)
+	valid, confirmations, err := verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, info.MinConfirmations, confirmations)
+
+	tests := []struct {
+		name      string
+		utxo      string
+		amount    uint64
+		recipient string
+	}{
+		{"amount not paid", utxoOf(tx, 2000), 2000, recipient},
+		{"utxo amount mismatch", utxoOf(tx, 1000), 2000, recipient},
+		{"receiver mismatch", utxoOf(tx, 1000), 1000, "0x0000000000000000000000000000000000000001"},
+		{"malformed utxo", "{", 1000, recipient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, _, err := verifier.VerifyBtcDeposit(context.Background(), tt.utxo, tt.amount, tt.recipient)
+			require.NoError(t, err)
+			require.False(t, valid)
+		})
+	}
+}
+
+// lyingBackend reports every output with value 1.
+type lyingBackend struct {
+	*bitcoin.MemoryBackend
+}
+
+func (b lyingBackend) GetTransaction(ctx context.Context, txHash *chainhash.Hash) (*bitcoin.Transaction, error) {
+	tx, err := b.MemoryBackend.GetTransaction(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tx.Outputs {
+		tx.Outputs[i].Value = 1
+	}
+	return tx, nil
+}
+
+func TestVerifyBtcDepositCrossCheck(t *testing.T) {
+	info := regtestInfo(t)
+	primary := bitcoin.NewMemoryBackend("primary", &chaincfg.RegressionNetParams)
+	secondary := bitcoin.NewMemoryBackend("secondary", &chaincfg.RegressionNetParams)
+	verifier, err := bitcoin.NewVerifierWithBackends(slog.Default(), info, primary, secondary)
+	require.NoError(t, err)
+
+	tx := depositTx(t, info, 1000)
+	primary.AddTransaction(tx, 10)
+	primary.Mine(5)
+	_, _, err = verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.ErrorIs(t, err, bitcoin.ErrTxNotFound)
+
+	secondary.AddTransaction(tx, 10)
+	secondary.Mine(5)
+	valid, _, err := verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	liar := bitcoin.NewMemoryBackend("liar", &chaincfg.RegressionNetParams)
+	liar.AddTransaction(tx, 10)
+	liar.Mine(5)
+	verifier, err = bitcoin.NewVerifierWithBackends(slog.Default(), info, primary, lyingBackend{liar})
+	require.NoError(t, err)
+	_, _, err = verifier.VerifyBtcDeposit(context.Background(), utxoOf(tx, 1000), 1000, recipient)
+	require.ErrorIs(t, err, bitcoin.ErrBackendsDisagree)
+}
+
+func TestEsploraBackend(t *testing.T) {
+	info := regtestInfo(t)
+	tx, other := depositTx(t, info, 1000), depositTx(t, info, 2000)
+	// served answers every /tx/ request, txid is the one it claims
+	served, txid := tx, tx.TxHash().String()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocks/tip/height", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "105")
+	})
+	mux.HandleFunc("/block-height/0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, chaincfg.RegressionNetParams.GenesisHash.String())
+	})
+	mux.HandleFunc("/tx/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tx/"+(chainhash.Hash{}).String() {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/hex") {
+			var raw bytes.Buffer
+			require.NoError(t, served.Serialize(&raw))
+			fmt.Fprint(w, hex.EncodeToString(raw.Bytes()))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"txid":   txid,
+			"status": map[string]any{"confirmed": true, "block_height": 100},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	backend := bitcoin.NewEsploraBackend(server.URL+"/", time.Second)
+	genesis, err := backend.GetBlockHash(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, chaincfg.RegressionNetParams.GenesisHash, genesis)
+
+	got, err := backend.GetTransaction(context.Background(), ptr(tx.TxHash()))
+	require.NoError(t, err)
+	require.Equal(t, int64(6), got.Confirmations)
+	require.Equal(t, int64(1000), got.Outputs[1].Value)
+
+	_, err = backend.GetTransaction(context.Background(), &chainhash.Hash{})
+	require.ErrorIs(t, err, bitcoin.ErrTxNotFound)
+
+	// A server answering with another tx is rejected
+	txid = other.TxHash().String()
+	_, err = backend.GetTransaction(context.Background(), ptr(tx.TxHash()))
+	require.ErrorContains(t, err, "esplora returned tx "+txid)
+	served, txid = other, tx.TxHash().String()
+	_, err = backend.GetTransaction(context.Background(), ptr(tx.TxHash()))
+	require.ErrorContains(t, err, "esplora returned tx "+other.TxHash().String())
+}
+
+// electrumServer serves the Electrum protocol on a local port, answering
+// each request with the result of handle.
+func electrumServer(t *testing.T, handle func(method string) any) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					var req struct {
+						Id     int    `json:"id"`
+						Method string `json:"method"`
+					}
+					json.Unmarshal(scanner.Bytes(), &req)
+					if req.Method == "blockchain.headers.subscribe" {
+						// A notification precedes the answer
+						fmt.Fprintln(conn, `{"jsonrpc":"2.0","method":"blockchain.headers.subscribe","params":[{"height":104}]}`)
+					}
+					bz, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req.Id, "result": handle(req.Method)})
+					conn.Write(append(bz, '\n'))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestElectrumBackend(t *testing.T) {
+	info := regtestInfo(t)
+	tx, other := depositTx(t, info, 1000), depositTx(t, info, 2000)
+	served := tx
+	addr := electrumServer(t, func(method string) any {
+		switch method {
+		case "blockchain.headers.subscribe":
+			return map[string]any{"height": 105}
+		case "blockchain.transaction.get":
+			var raw bytes.Buffer
+			require.NoError(t, served.Serialize(&raw))
+			return map[string]any{"hex": hex.EncodeToString(raw.Bytes()), "confirmations": 3}
+		}
+		return nil
+	})
+
+	backend := bitcoin.NewElectrumBackend(addr, false, time.Second)
+	height, err := backend.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(105), height)
+
+	got, err := backend.GetTransaction(context.Background(), ptr(tx.TxHash()))
+	require.NoError(t, err)
+	require.Equal(t, tx.TxHash().String(), got.TxHash)
+	require.Equal(t, int64(3), got.Confirmations)
+	require.Len(t, got.Outputs, 2)
+
+	// A server answering with another tx is rejected
+	served = other
+	_, err = backend.GetTransaction(context.Background(), ptr(tx.TxHash()))
+	require.ErrorContains(t, err, "electrum returned tx "+other.TxHash().String())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
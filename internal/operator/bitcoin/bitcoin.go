@@ -1,27 +1,41 @@
 package bitcoin
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Verifier interface {
 	GetMultisigAddr() string
+	GetPublicKey() string
+	GetBlockCount(ctx context.Context) (int64, error)
+	GetBlockChainInfo(ctx context.Context) (*btcjson.GetBlockChainInfoResult, error)
 
-	VerifyBtcDeposit(utxo string, amount uint64, recipient string) (bool, error)
-	VerifyTokenDeposit(utxo string) (bool, error)
-	VerifyInscriptionDeposit(utxo string) (bool, error)
-	Sign(tx *wire.MsgTx) ([]byte, error)
+	VerifyBtcDeposit(ctx context.Context, utxo string, amount uint64, recipient string) (bool, int64, error)
+	VerifyTokenDeposit(ctx context.Context, utxo string) (bool, error)
+	VerifyInscriptionDeposit(ctx context.Context, utxo string) (bool, error)
+	Sign(ctx context.Context, tx *wire.MsgTx) ([]byte, error)
 	ConvertToAddress(pk []byte) (string, error)
 }
 
@@ -44,19 +58,37 @@ func (u *UtxoDef) String() string {
 	return string(bz)
 }
 func UtxoFromStr(s string) UtxoDef {
-	bz := []byte(s)
-	var u UtxoDef
-	err := json.Unmarshal(bz, &u)
+	u, err := ParseUtxo(s)
 	if err != nil {
 		panic(err)
 	}
 	return u
 }
 
+// ParseUtxo decodes the utxo string of an incoming invoice.
+func ParseUtxo(s string) (UtxoDef, error) {
+	var u UtxoDef
+	if err := json.Unmarshal([]byte(s), &u); err != nil {
+		return u, fmt.Errorf("invalid utxo %q: %w", s, err)
+	}
+	return u, nil
+}
+
+var (
+	// ErrNotConfirmed is returned while a deposit has fewer than
+	// min-confirmations confirmations.
+	ErrNotConfirmed = errors.New("deposit not confirmed")
+	// ErrBackendsDisagree is returned when chain backends give different
+	// verdicts on a deposit.
+	ErrBackendsDisagree = errors.New("bitcoin backends disagree")
+)
+
 type verifierImpl struct {
 	logger       *slog.Logger
+	mu           sync.RWMutex
 	info         config.BitcoinInfo
-	client       *rpcclient.Client
+	rpc          *rpcPool
+	backends     []ChainBackend
 	redeemScript []byte
 	privateKey   *btcec.PrivateKey
 	chainParam   *chaincfg.Params
@@ -64,33 +96,169 @@ type verifierImpl struct {
 
 // GetMultisigAddr implements Verifier.
 func (v *verifierImpl) GetMultisigAddr() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 	return v.info.MultisigAddress
 }
 
-// VerifyBtcDeposit implements Verifier.
-func (v *verifierImpl) VerifyBtcDeposit(utxo string, amount uint64, recipient string) (bool, error) {
-	utxoDef := UtxoFromStr(utxo)
+// GetPublicKey implements Verifier.
+func (v *verifierImpl) GetPublicKey() string {
+	return hex.EncodeToString(v.privateKey.PubKey().SerializeCompressed())
+}
+
+// UpdateConfig applies the live fields of info, see config.Diff.
+func (v *verifierImpl) UpdateConfig(info config.BitcoinInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.info = info
+}
+
+func (v *verifierImpl) minConfirmations() int64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.info.MinConfirmations
+}
+
+// GetBlockCount implements Verifier. The height is the one of the first backend.
+func (v *verifierImpl) GetBlockCount(ctx context.Context) (height int64, err error) {
+	_, span := tracing.Start(ctx, "bitcoin.GetBlockCount", attribute.String("backend", v.backends[0].Name()))
+	defer tracing.End(span, &err)
+	return v.backends[0].GetBlockCount(ctx)
+}
+
+// GetBlockChainInfo implements Verifier. Without bitcoind among the backends,
+// the info is derived from the tip of the first backend and never reports an
+// initial block download.
+func (v *verifierImpl) GetBlockChainInfo(ctx context.Context) (info *btcjson.GetBlockChainInfoResult, err error) {
+	_, span := tracing.Start(ctx, "bitcoin.GetBlockChainInfo")
+	defer tracing.End(span, &err)
+	if v.rpc != nil {
+		defer metrics.ObserveRPC(metrics.ChainBitcoin, "getblockchaininfo", time.Now(), &err)
+		return rpcCall(ctx, v.rpc, "getblockchaininfo", (*rpcclient.Client).GetBlockChainInfo)
+	}
+
+	height, err := v.backends[0].GetBlockCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := v.backends[0].GetBlockHash(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.GetBlockChainInfoResult{
+		Chain:         BitcoindChainName(v.chainParam),
+		Blocks:        int32(height),
+		Headers:       int32(height),
+		BestBlockHash: hash.String(),
+	}, nil
+}
+
+// VerifyBtcDeposit implements Verifier. A deposit is valid when its tx pays
+// amount to the multisig address with at least min-confirmations. With
+// several backends every one of them must reach the same verdict. Deposits
+// not found or not confirmed yet are reported as errors, to be retried.
+// It also returns the fewest confirmations of the deposit tx the backends
+// reported.
+func (v *verifierImpl) VerifyBtcDeposit(ctx context.Context, utxo string, amount uint64, recipient string) (valid bool, confirmations int64, err error) {
+	ctx, span := tracing.Start(ctx, "bitcoin.VerifyBtcDeposit")
+	defer tracing.End(span, &err)
+
+	utxoDef, err := ParseUtxo(utxo)
+	if err != nil {
+		v.logger.Info("btc deposit has malformed utxo", "err", err)
+		return false, 0, nil
+	}
 	txHash, err := chainhash.NewHashFromStr(utxoDef.TxHash)
 	if err != nil {
-		return false, err
+		v.logger.Info("btc deposit has malformed tx hash", "tx_hash", utxoDef.TxHash, "err", err)
+		return false, 0, nil
 	}
 
-	tx, err := v.client.GetRawTransactionVerbose(txHash)
+	var first ChainBackend
+	var verdict bool
+	for _, backend := range v.backends {
+		valid, seen, err := v.verifyDeposit(ctx, backend, txHash, utxoDef, amount, recipient)
+		if err != nil {
+			v.logger.Error("verify btc deposit error", "backend", backend.Name(), "tx_hash", txHash, "err", err)
+			return false, 0, fmt.Errorf("%s: %w", backend.Name(), err)
+		}
+		if first != nil && valid != verdict {
+			v.logger.Error("bitcoin backends disagree on deposit", "tx_hash", txHash,
+				first.Name(), verdict, backend.Name(), valid)
+			return false, 0, fmt.Errorf("%w on %s: %s says %t, %s says %t", ErrBackendsDisagree, txHash,
+				first.Name(), verdict, backend.Name(), valid)
+		}
+		if first == nil || seen < confirmations {
+			confirmations = seen
+		}
+		first, verdict = backend, valid
+	}
+	return verdict, confirmations, nil
+}
+
+func (v *verifierImpl) verifyDeposit(ctx context.Context, backend ChainBackend, txHash *chainhash.Hash, utxo UtxoDef, amount uint64, recipient string) (bool, int64, error) {
+	_, span := tracing.Start(ctx, "bitcoin.GetTransaction",
+		attribute.String("backend", backend.Name()), attribute.String("tx_hash", txHash.String()))
+	tx, err := backend.GetTransaction(ctx, txHash)
+	tracing.End(span, &err)
 	if err != nil {
-		v.logger.Error("get raw transaction verbose error", "err", err, "tx_hash", txHash)
-		return false, err
+		return false, 0, err
+	}
+	if minConfirmations := v.minConfirmations(); tx.Confirmations < minConfirmations {
+		return false, tx.Confirmations, fmt.Errorf("%w: %s has %d of %d confirmations", ErrNotConfirmed, txHash, tx.Confirmations, minConfirmations)
+	}
+
+	if utxo.Amount != 0 && utxo.Amount != amount {
+		v.logger.Info("btc deposit utxo amount mismatch", "tx_hash", txHash, "utxo_amount", utxo.Amount, "amount", amount)
+		return false, tx.Confirmations, nil
+	}
+	if common.IsHexAddress(utxo.Receiver) && common.HexToAddress(utxo.Receiver) != common.HexToAddress(recipient) {
+		v.logger.Info("btc deposit utxo receiver mismatch", "tx_hash", txHash, "receiver", utxo.Receiver, "recipient", recipient)
+		return false, tx.Confirmations, nil
 	}
+	for _, out := range tx.Outputs {
+		if out.Value != int64(amount) {
+			continue
+		}
+		if addr, err := v.outputAddress(out.PkScript); err == nil && addr == v.GetMultisigAddr() {
+			return true, tx.Confirmations, nil
+		}
+	}
+	v.logger.Info("btc deposit has no output paying the multisig address", "tx_hash", txHash, "amount", amount)
+	return false, tx.Confirmations, nil
+}
 
-	for index, vout := range tx.Vout {
-		_ = index
-		_ = vout
+// outputAddress is ConvertToAddress without logging, for outputs such as
+// OP_RETURN that have no address.
+func (v *verifierImpl) outputAddress(pkScript []byte) (string, error) {
+	pk, err := txscript.ParsePkScript(pkScript)
+	if err != nil {
+		return "", err
 	}
-	return true, nil
+	addr, err := pk.Address(v.chainParam)
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
 }
 
 // Sign implements Verifier.
-func (v *verifierImpl) Sign(tx *wire.MsgTx) ([]byte, error) {
-	return txscript.SignatureScript(tx, 0, v.redeemScript, txscript.SigHashAll, v.privateKey, true)
+func (v *verifierImpl) Sign(ctx context.Context, tx *wire.MsgTx) (signature []byte, err error) {
+	_, span := tracing.Start(ctx, "bitcoin.Sign", attribute.String("btc_txid", tx.TxHash().String()))
+	defer tracing.End(span, &err)
+
+	signature, err = txscript.SignatureScript(tx, 0, v.redeemScript, txscript.SigHashAll, v.privateKey, true)
+	if err != nil {
+		metrics.SignerOps.WithLabelValues(metrics.ChainBitcoin, "error").Inc()
+		return nil, err
+	}
+	metrics.SignerOps.WithLabelValues(metrics.ChainBitcoin, "ok").Inc()
+	return signature, nil
+}
+
+// SigHash returns the hash Sign signs for tx.
+func (v *verifierImpl) SigHash(tx *wire.MsgTx) ([]byte, error) {
+	return txscript.CalcSignatureHash(v.redeemScript, txscript.SigHashAll, tx, 0)
 }
 
 // ConvertToAddress implements Verifier.
@@ -112,27 +280,48 @@ func (v *verifierImpl) ConvertToAddress(pkScript []byte) (string, error) {
 }
 
 // VerifyInscriptionDeposit implements Verifier.
-func (v *verifierImpl) VerifyInscriptionDeposit(utxo string) (bool, error) {
+func (v *verifierImpl) VerifyInscriptionDeposit(ctx context.Context, utxo string) (bool, error) {
 	panic("unimplemented")
 }
 
 // VerifyTokenDeposit implements Verifier.
-func (v *verifierImpl) VerifyTokenDeposit(utxo string) (bool, error) {
+func (v *verifierImpl) VerifyTokenDeposit(ctx context.Context, utxo string) (bool, error) {
 	panic("unimplemented")
 }
 
 func NewVerifier(logger *slog.Logger, info config.BitcoinInfo) (Verifier, error) {
-	connCfg := rpcclient.ConnConfig{
-		Host:         info.Host,
-		User:         info.User,
-		Pass:         info.Pass,
-		DisableTLS:   true,
-		HTTPPostMode: true,
+	return NewVerifierWithTransport(logger, info, nil)
+}
+
+// NewVerifierWithTransport returns a verifier sending the http requests of
+// its backends with transport, such as an rpctrace recorder.
+func NewVerifierWithTransport(logger *slog.Logger, info config.BitcoinInfo, transport http.RoundTripper) (Verifier, error) {
+	backends, rpc, err := newChainBackends(logger, info, transport)
+	if err != nil {
+		return nil, err
 	}
-	client, err := rpcclient.New(&connCfg, nil)
+	verifier, err := NewVerifierWithBackends(logger, info, backends...)
 	if err != nil {
 		return nil, err
 	}
+
+	v := verifier.(*verifierImpl)
+	v.rpc = rpc
+	if err := v.checkNetwork(context.Background()); err != nil {
+		if rpc != nil {
+			rpc.shutdown()
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// NewVerifierWithBackends returns a verifier checking deposits against
+// backends, the first of which also reports the chain height.
+func NewVerifierWithBackends(logger *slog.Logger, info config.BitcoinInfo, backends ...ChainBackend) (Verifier, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no bitcoin backend")
+	}
 	pk, err := btcutil.DecodeWIF(info.PrivateKey)
 	if err != nil {
 		return nil, err
@@ -143,19 +332,77 @@ func NewVerifier(logger *slog.Logger, info config.BitcoinInfo) (Verifier, error)
 		return nil, err
 	}
 
-	chainParam := &chaincfg.MainNetParams
-	if info.Network == "testnet" {
-		chainParam = &chaincfg.TestNet3Params
+	chainParam, err := info.ChainParams()
+	if err != nil {
+		return nil, err
 	}
 
 	return &verifierImpl{
 		logger:       logger,
-		client:       client,
 		info:         info,
+		backends:     backends,
 		privateKey:   pk.PrivKey,
 		redeemScript: redeemScript,
 		chainParam:   chainParam,
 	}, nil
 }
 
+// checkNetwork makes sure every backend serves the configured network, so
+// addresses are never derived with the params of another chain. bitcoind
+// nodes are checked by the chain name they report, other backends by their
+// genesis block.
+func (v *verifierImpl) checkNetwork(ctx context.Context) error {
+	for _, backend := range v.backends {
+		if _, ok := backend.(*bitcoindBackend); ok {
+			if err := v.checkBitcoindNetwork(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		genesis, err := backend.GetBlockHash(ctx, 0)
+		if err != nil {
+			v.logger.Error("get genesis block error", "backend", backend.Name(), "err", err)
+			return fmt.Errorf("check %s network: %w", backend.Name(), err)
+		}
+		if !genesis.IsEqual(v.chainParam.GenesisHash) {
+			return fmt.Errorf("%s serves genesis block %s but network %q expects %s", backend.Name(), genesis, v.info.Network, v.chainParam.GenesisHash)
+		}
+	}
+	return nil
+}
+
+// checkBitcoindNetwork makes sure every reachable bitcoind runs the
+// configured network.
+func (v *verifierImpl) checkBitcoindNetwork(ctx context.Context) error {
+	expected := BitcoindChainName(v.chainParam)
+	reachable := 0
+	for _, node := range v.rpc.nodes {
+		info, err := callNode(ctx, node, v.rpc.timeout, (*rpcclient.Client).GetBlockChainInfo)
+		if err != nil {
+			v.logger.Error("get blockchain info error", "host", node.host, "err", err)
+			continue
+		}
+		reachable++
+		if info.Chain != expected {
+			return fmt.Errorf("bitcoind %s runs chain %q but network %q expects %q", node.host, info.Chain, v.info.Network, expected)
+		}
+	}
+	if reachable == 0 {
+		return fmt.Errorf("check bitcoind network: no bitcoind host reachable")
+	}
+	return nil
+}
+
+// BitcoindChainName returns the chain name getblockchaininfo reports for params.
+func BitcoindChainName(params *chaincfg.Params) string {
+	switch params.Name {
+	case chaincfg.MainNetParams.Name:
+		return "main"
+	case chaincfg.TestNet3Params.Name:
+		return "test"
+	default:
+		return params.Name
+	}
+}
+
 var _ Verifier = &verifierImpl{}
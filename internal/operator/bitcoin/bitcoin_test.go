@@ -3,6 +3,7 @@ package bitcoin_test
 import (
 	"testing"
 
+	"github.com/aura-nw/lotus-operator/config"
 	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
 	"github.com/stretchr/testify/require"
 )
@@ -22,3 +23,19 @@ func TestUtxo(t *testing.T) {
 	reUtxo := bitcoin.UtxoFromStr(utxoStr)
 	require.Equal(t, utxo.Height, reUtxo.Height)
 }
+
+func TestBitcoindChainName(t *testing.T) {
+	tests := map[string]string{
+		config.NetworkMainnet:  "main",
+		config.NetworkTestnet3: "test",
+		config.NetworkTestnet4: "testnet4",
+		config.NetworkSignet:   "signet",
+		config.NetworkRegtest:  "regtest",
+	}
+	for network, chain := range tests {
+		info := config.BitcoinInfo{Network: network}
+		params, err := info.ChainParams()
+		require.NoError(t, err)
+		require.Equal(t, chain, bitcoin.BitcoindChainName(params), network)
+	}
+}
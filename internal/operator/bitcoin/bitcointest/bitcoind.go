@@ -0,0 +1,216 @@
+// Package bitcointest provides an in-process bitcoind for operator tests.
+package bitcointest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// User and Pass are the RPC credentials Bitcoind accepts.
+	User = "lotus"
+	Pass = "lotus"
+)
+
+// Bitcoind serves the bitcoind JSON-RPC methods the operator calls from a
+// scripted in-memory chain: getnetworkinfo, getblockchaininfo, getblockcount,
+// getblockhash and getrawtransaction. Transactions and blocks are scripted
+// with AddTransaction and Mine.
+type Bitcoind struct {
+	chain  *bitcoin.MemoryBackend
+	params *chaincfg.Params
+	server *httptest.Server
+
+	mu  sync.RWMutex
+	txs map[chainhash.Hash]*wire.MsgTx
+	err *btcjson.RPCError
+}
+
+// NewBitcoind starts a bitcoind serving an empty chain of params. Close it
+// when done.
+func NewBitcoind(params *chaincfg.Params) *Bitcoind {
+	b := &Bitcoind{
+		chain:  bitcoin.NewMemoryBackend(config.BackendBitcoind, params),
+		params: params,
+		txs:    make(map[chainhash.Hash]*wire.MsgTx),
+	}
+	b.server = httptest.NewServer(b)
+	return b
+}
+
+// Host returns the host:port to use as bitcoin.host.
+func (b *Bitcoind) Host() string {
+	return strings.TrimPrefix(b.server.URL, "http://")
+}
+
+// Configure points info to the bitcoind.
+func (b *Bitcoind) Configure(info *config.BitcoinInfo) {
+	info.Host = b.Host()
+	info.User = User
+	info.Pass = Pass
+	info.Backends = []string{config.BackendBitcoind}
+}
+
+// Close stops the bitcoind.
+func (b *Bitcoind) Close() {
+	b.server.Close()
+}
+
+// AddTransaction adds tx to the mempool, or to the block at height when
+// height is positive.
+func (b *Bitcoind) AddTransaction(tx *wire.MsgTx, height int64) {
+	b.mu.Lock()
+	b.txs[tx.TxHash()] = tx
+	b.mu.Unlock()
+	b.chain.AddTransaction(tx, height)
+}
+
+// Mine advances the chain by n blocks.
+func (b *Bitcoind) Mine(n int64) {
+	b.chain.Mine(n)
+}
+
+// BlockCount returns the chain height.
+func (b *Bitcoind) BlockCount() int64 {
+	height, _ := b.chain.GetBlockCount(context.Background())
+	return height
+}
+
+// SetError makes every call fail with err until it is set back to nil.
+func (b *Bitcoind) SetError(err *btcjson.RPCError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+type request struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// ServeHTTP implements http.Handler.
+func (b *Bitcoind) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pass, _ := r.BasicAuth()
+	if user != User || pass != Pass {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, rpcErr := b.handle(req)
+	resp := map[string]any{"id": req.Id, "result": result, "error": rpcErr}
+	if rpcErr != nil {
+		resp["result"] = nil
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (b *Bitcoind) handle(req request) (any, *btcjson.RPCError) {
+	b.mu.RLock()
+	rpcErr := b.err
+	b.mu.RUnlock()
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	switch req.Method {
+	case "getnetworkinfo":
+		// rpcclient detects the bitcoind version from it
+		return btcjson.GetNetworkInfoResult{Version: 260000, SubVersion: "/Satoshi:26.0.0/"}, nil
+	case "getblockchaininfo":
+		height := b.BlockCount()
+		hash, _ := b.chain.GetBlockHash(context.Background(), height)
+		return btcjson.GetBlockChainInfoResult{
+			Chain:         bitcoin.BitcoindChainName(b.params),
+			Blocks:        int32(height),
+			Headers:       int32(height),
+			BestBlockHash: hash.String(),
+		}, nil
+	case "getblockcount":
+		return b.BlockCount(), nil
+	case "getblockhash":
+		var height int64
+		if err := unmarshalParam(req, 0, &height); err != nil {
+			return nil, invalidParams(err)
+		}
+		hash, err := b.chain.GetBlockHash(context.Background(), height)
+		if err != nil {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCOutOfRange, err.Error())
+		}
+		return hash.String(), nil
+	case "getrawtransaction":
+		var txid string
+		if err := unmarshalParam(req, 0, &txid); err != nil {
+			return nil, invalidParams(err)
+		}
+		return b.getRawTransaction(txid)
+	default:
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMethodNotFound.Code, "Method not found")
+	}
+}
+
+func (b *Bitcoind) getRawTransaction(txid string) (any, *btcjson.RPCError) {
+	txHash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	b.mu.RLock()
+	msgTx, ok := b.txs[*txHash]
+	b.mu.RUnlock()
+	tx, err := b.chain.GetTransaction(context.Background(), txHash)
+	if !ok || err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCNoTxInfo, "No such mempool or blockchain transaction")
+	}
+
+	var raw bytes.Buffer
+	if err := msgTx.Serialize(&raw); err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+	}
+	result := btcjson.TxRawResult{
+		Hex:           hex.EncodeToString(raw.Bytes()),
+		Txid:          tx.TxHash,
+		Hash:          msgTx.WitnessHash().String(),
+		Version:       uint32(msgTx.Version),
+		LockTime:      msgTx.LockTime,
+		Confirmations: uint64(tx.Confirmations),
+	}
+	for i, out := range tx.Outputs {
+		result.Vout = append(result.Vout, btcjson.Vout{
+			Value:        btcutil.Amount(out.Value).ToBTC(),
+			N:            uint32(i),
+			ScriptPubKey: btcjson.ScriptPubKeyResult{Hex: hex.EncodeToString(out.PkScript)},
+		})
+	}
+	return result, nil
+}
+
+func unmarshalParam(req request, i int, v any) error {
+	if i >= len(req.Params) {
+		return errors.New("missing parameter")
+	}
+	return json.Unmarshal(req.Params[i], v)
+}
+
+func invalidParams(err error) *btcjson.RPCError {
+	return btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, err.Error())
+}
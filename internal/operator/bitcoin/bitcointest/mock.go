@@ -0,0 +1,131 @@
+package bitcointest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrNotMocked is returned by mock methods without a function set.
+var ErrNotMocked = errors.New("bitcointest: method not mocked")
+
+// MockVerifier implements bitcoin.Verifier with a function per method, for
+// tests scripting each answer. Methods without a function return
+// ErrNotMocked.
+type MockVerifier struct {
+	MultisigAddr string
+	PublicKey    string
+
+	GetBlockCountFn            func() (int64, error)
+	GetBlockChainInfoFn        func() (*btcjson.GetBlockChainInfoResult, error)
+	VerifyBtcDepositFn         func(utxo string, amount uint64, recipient string) (bool, int64, error)
+	VerifyTokenDepositFn       func(utxo string) (bool, error)
+	VerifyInscriptionDepositFn func(utxo string) (bool, error)
+	SignFn                     func(tx *wire.MsgTx) ([]byte, error)
+	ConvertToAddressFn         func(pk []byte) (string, error)
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// Calls returns how many times method was called.
+func (m *MockVerifier) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+func (m *MockVerifier) called(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[method]++
+}
+
+func notMocked(method string) error {
+	return fmt.Errorf("%w: %s", ErrNotMocked, method)
+}
+
+// GetMultisigAddr implements bitcoin.Verifier.
+func (m *MockVerifier) GetMultisigAddr() string {
+	m.called("GetMultisigAddr")
+	return m.MultisigAddr
+}
+
+// GetPublicKey implements bitcoin.Verifier.
+func (m *MockVerifier) GetPublicKey() string {
+	m.called("GetPublicKey")
+	return m.PublicKey
+}
+
+// GetBlockCount implements bitcoin.Verifier.
+func (m *MockVerifier) GetBlockCount(ctx context.Context) (int64, error) {
+	m.called("GetBlockCount")
+	if m.GetBlockCountFn == nil {
+		return 0, notMocked("GetBlockCount")
+	}
+	return m.GetBlockCountFn()
+}
+
+// GetBlockChainInfo implements bitcoin.Verifier.
+func (m *MockVerifier) GetBlockChainInfo(ctx context.Context) (*btcjson.GetBlockChainInfoResult, error) {
+	m.called("GetBlockChainInfo")
+	if m.GetBlockChainInfoFn == nil {
+		return nil, notMocked("GetBlockChainInfo")
+	}
+	return m.GetBlockChainInfoFn()
+}
+
+// VerifyBtcDeposit implements bitcoin.Verifier.
+func (m *MockVerifier) VerifyBtcDeposit(ctx context.Context, utxo string, amount uint64, recipient string) (bool, int64, error) {
+	m.called("VerifyBtcDeposit")
+	if m.VerifyBtcDepositFn == nil {
+		return false, 0, notMocked("VerifyBtcDeposit")
+	}
+	return m.VerifyBtcDepositFn(utxo, amount, recipient)
+}
+
+// VerifyTokenDeposit implements bitcoin.Verifier.
+func (m *MockVerifier) VerifyTokenDeposit(ctx context.Context, utxo string) (bool, error) {
+	m.called("VerifyTokenDeposit")
+	if m.VerifyTokenDepositFn == nil {
+		return false, notMocked("VerifyTokenDeposit")
+	}
+	return m.VerifyTokenDepositFn(utxo)
+}
+
+// VerifyInscriptionDeposit implements bitcoin.Verifier.
+func (m *MockVerifier) VerifyInscriptionDeposit(ctx context.Context, utxo string) (bool, error) {
+	m.called("VerifyInscriptionDeposit")
+	if m.VerifyInscriptionDepositFn == nil {
+		return false, notMocked("VerifyInscriptionDeposit")
+	}
+	return m.VerifyInscriptionDepositFn(utxo)
+}
+
+// Sign implements bitcoin.Verifier.
+func (m *MockVerifier) Sign(ctx context.Context, tx *wire.MsgTx) ([]byte, error) {
+	m.called("Sign")
+	if m.SignFn == nil {
+		return nil, notMocked("Sign")
+	}
+	return m.SignFn(tx)
+}
+
+// ConvertToAddress implements bitcoin.Verifier.
+func (m *MockVerifier) ConvertToAddress(pk []byte) (string, error) {
+	m.called("ConvertToAddress")
+	if m.ConvertToAddressFn == nil {
+		return "", notMocked("ConvertToAddress")
+	}
+	return m.ConvertToAddressFn(pk)
+}
+
+var _ bitcoin.Verifier = &MockVerifier{}
@@ -0,0 +1,208 @@
+package bitcoin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// electrumProtocolVersion is the Electrum protocol version the backend speaks.
+const electrumProtocolVersion = "1.4"
+
+// ElectrumBackend implements ChainBackend with the Electrum protocol, as
+// served by ElectrumX, Fulcrum or electrs. The server must answer verbose
+// blockchain.transaction.get requests.
+type ElectrumBackend struct {
+	host    string
+	useTLS  bool
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	nextId int
+}
+
+// NewElectrumBackend returns a backend querying the Electrum server at host,
+// as host:port. The connection is opened on first use.
+func NewElectrumBackend(host string, useTLS bool, timeout time.Duration) *ElectrumBackend {
+	return &ElectrumBackend{host: host, useTLS: useTLS, timeout: timeout}
+}
+
+type electrumResponse struct {
+	Id     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// Name implements ChainBackend.
+func (b *ElectrumBackend) Name() string {
+	return config.BackendElectrum
+}
+
+// GetBlockCount implements ChainBackend.
+func (b *ElectrumBackend) GetBlockCount(ctx context.Context) (height int64, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "electrum_headers_subscribe", time.Now(), &err)
+	var tip struct {
+		Height int64 `json:"height"`
+	}
+	if err := b.call(ctx, "blockchain.headers.subscribe", nil, &tip); err != nil {
+		return 0, err
+	}
+	return tip.Height, nil
+}
+
+// GetBlockHash implements ChainBackend.
+func (b *ElectrumBackend) GetBlockHash(ctx context.Context, height int64) (hash *chainhash.Hash, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "electrum_block_header", time.Now(), &err)
+	var headerHex string
+	if err := b.call(ctx, "blockchain.block.header", []any{height}, &headerHex); err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(headerHex)
+	if err != nil {
+		return nil, err
+	}
+	var header wire.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	blockHash := header.BlockHash()
+	return &blockHash, nil
+}
+
+// GetTransaction implements ChainBackend. The transaction is fetched
+// verbose, which reports its confirmations, and rejected unless it hashes to
+// txHash.
+func (b *ElectrumBackend) GetTransaction(ctx context.Context, txHash *chainhash.Hash) (tx *Transaction, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "electrum_transaction_get", time.Now(), &err)
+	var verbose struct {
+		Hex           string `json:"hex"`
+		Confirmations int64  `json:"confirmations"`
+	}
+	if err := b.call(ctx, "blockchain.transaction.get", []any{txHash.String(), true}, &verbose); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "not found") {
+			return nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+		}
+		return nil, err
+	}
+	raw, err := hex.DecodeString(verbose.Hex)
+	if err != nil {
+		return nil, err
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	if got := msgTx.TxHash(); !got.IsEqual(txHash) {
+		return nil, fmt.Errorf("electrum returned tx %s for %s", got, txHash)
+	}
+
+	tx = &Transaction{TxHash: txHash.String(), Confirmations: verbose.Confirmations}
+	for _, out := range msgTx.TxOut {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: out.Value, PkScript: out.PkScript})
+	}
+	return tx, nil
+}
+
+// call sends one request and decodes its result into result. The connection
+// is dropped on any error, including ctx being done, and reopened by the next
+// call.
+func (b *ElectrumBackend) call(ctx context.Context, method string, params []any, result any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.connect(ctx); err != nil {
+		return err
+	}
+	resp, err := b.roundTrip(ctx, method, params)
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("electrum %s: %w", method, err)
+	}
+	if len(resp.Error) > 0 && string(resp.Error) != "null" {
+		return fmt.Errorf("electrum %s: %s", method, resp.Error)
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+func (b *ElectrumBackend) connect(ctx context.Context) error {
+	if b.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: b.timeout}
+	var conn net.Conn
+	var err error
+	if b.useTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", b.host)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", b.host)
+	}
+	if err != nil {
+		return fmt.Errorf("connect electrum %s: %w", b.host, err)
+	}
+	b.conn, b.reader = conn, bufio.NewReader(conn)
+
+	if _, err := b.roundTrip(ctx, "server.version", []any{"lotus-operator", electrumProtocolVersion}); err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("negotiate electrum version: %w", err)
+	}
+	return nil
+}
+
+func (b *ElectrumBackend) roundTrip(ctx context.Context, method string, params []any) (*electrumResponse, error) {
+	if params == nil {
+		params = []any{}
+	}
+	b.nextId++
+	id := b.nextId
+	req, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.conn.SetDeadline(time.Now().Add(b.timeout)); err != nil {
+		return nil, err
+	}
+	// Unblock the write or read when ctx is done before the server answers
+	conn := b.conn
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if _, err := b.conn.Write(append(req, '\n')); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := b.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var resp electrumResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return nil, err
+		}
+		// Skip notifications of earlier subscriptions
+		if resp.Id != nil && *resp.Id == id {
+			return &resp, nil
+		}
+	}
+}
+
+var _ ChainBackend = &ElectrumBackend{}
@@ -0,0 +1,139 @@
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// EsploraBackend implements ChainBackend with the Esplora REST API, as served
+// by blockstream.info, mempool.space or a self-hosted electrs.
+type EsploraBackend struct {
+	baseUrl string
+	client  *http.Client
+}
+
+// NewEsploraBackend returns a backend querying the Esplora API at baseUrl,
+// e.g. https://blockstream.info/testnet/api.
+func NewEsploraBackend(baseUrl string, timeout time.Duration) *EsploraBackend {
+	return &EsploraBackend{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+type esploraTx struct {
+	Txid   string `json:"txid"`
+	Status struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int64 `json:"block_height"`
+	} `json:"status"`
+}
+
+// Name implements ChainBackend.
+func (b *EsploraBackend) Name() string {
+	return config.BackendEsplora
+}
+
+// GetBlockCount implements ChainBackend.
+func (b *EsploraBackend) GetBlockCount(ctx context.Context) (height int64, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "esplora_tip_height", time.Now(), &err)
+	body, err := b.get(ctx, "/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+}
+
+// GetBlockHash implements ChainBackend.
+func (b *EsploraBackend) GetBlockHash(ctx context.Context, height int64) (hash *chainhash.Hash, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "esplora_block_height", time.Now(), &err)
+	body, err := b.get(ctx, fmt.Sprintf("/block-height/%d", height))
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(strings.TrimSpace(string(body)))
+}
+
+// GetTransaction implements ChainBackend. The outputs are decoded from the
+// raw transaction, which is rejected unless it hashes to txHash.
+func (b *EsploraBackend) GetTransaction(ctx context.Context, txHash *chainhash.Hash) (tx *Transaction, err error) {
+	defer metrics.ObserveRPC(metrics.ChainBitcoin, "esplora_tx", time.Now(), &err)
+	body, err := b.get(ctx, "/tx/"+txHash.String())
+	if err != nil {
+		return nil, err
+	}
+	var status esploraTx
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("decode esplora tx: %w", err)
+	}
+	if status.Txid != txHash.String() {
+		return nil, fmt.Errorf("esplora returned tx %s for %s", status.Txid, txHash)
+	}
+	body, err = b.get(ctx, "/tx/"+txHash.String()+"/hex")
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	if got := msgTx.TxHash(); !got.IsEqual(txHash) {
+		return nil, fmt.Errorf("esplora returned tx %s for %s", got, txHash)
+	}
+
+	tx = &Transaction{TxHash: txHash.String()}
+	if status.Status.Confirmed {
+		tip, err := b.GetBlockCount(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx.Confirmations = tip - status.Status.BlockHeight + 1
+	}
+	for _, out := range msgTx.TxOut {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: out.Value, PkScript: out.PkScript})
+	}
+	return tx, nil
+}
+
+func (b *EsploraBackend) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseUrl+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/tx/"):
+		return nil, fmt.Errorf("%w: %s", ErrTxNotFound, strings.TrimPrefix(path, "/tx/"))
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("esplora %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+var _ ChainBackend = &EsploraBackend{}
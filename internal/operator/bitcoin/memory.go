@@ -0,0 +1,116 @@
+package bitcoin
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MemoryBackend implements ChainBackend with an in-memory chain, for tests.
+type MemoryBackend struct {
+	name   string
+	params *chaincfg.Params
+
+	mu     sync.RWMutex
+	height int64
+	txs    map[chainhash.Hash]memoryTx
+	err    error
+}
+
+type memoryTx struct {
+	tx     *wire.MsgTx
+	height int64
+}
+
+// NewMemoryBackend returns an empty chain of params, at height 0.
+func NewMemoryBackend(name string, params *chaincfg.Params) *MemoryBackend {
+	return &MemoryBackend{
+		name:   name,
+		params: params,
+		txs:    make(map[chainhash.Hash]memoryTx),
+	}
+}
+
+// AddTransaction adds tx to the mempool, or to the block at height when
+// height is positive.
+func (b *MemoryBackend) AddTransaction(tx *wire.MsgTx, height int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.txs[tx.TxHash()] = memoryTx{tx: tx, height: height}
+	b.height = max(b.height, height)
+}
+
+// Mine advances the chain by n blocks.
+func (b *MemoryBackend) Mine(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.height += n
+}
+
+// SetError makes every call fail with err until it is set back to nil.
+func (b *MemoryBackend) SetError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+// Name implements ChainBackend.
+func (b *MemoryBackend) Name() string {
+	return b.name
+}
+
+// GetBlockCount implements ChainBackend.
+func (b *MemoryBackend) GetBlockCount(ctx context.Context) (int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.height, b.err
+}
+
+// GetBlockHash implements ChainBackend. Blocks other than genesis get a hash
+// derived from their height.
+func (b *MemoryBackend) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if height < 0 || height > b.height {
+		return nil, fmt.Errorf("block %d out of range", height)
+	}
+	if height == 0 {
+		return b.params.GenesisHash, nil
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(height))
+	hash := chainhash.DoubleHashH(buf[:])
+	return &hash, nil
+}
+
+// GetTransaction implements ChainBackend.
+func (b *MemoryBackend) GetTransaction(ctx context.Context, txHash *chainhash.Hash) (*Transaction, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	stored, ok := b.txs[*txHash]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+	}
+
+	tx := &Transaction{TxHash: txHash.String()}
+	if stored.height > 0 {
+		tx.Confirmations = b.height - stored.height + 1
+	}
+	for _, out := range stored.tx.TxOut {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: out.Value, PkScript: out.PkScript})
+	}
+	return tx, nil
+}
+
+var _ ChainBackend = &MemoryBackend{}
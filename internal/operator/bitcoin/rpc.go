@@ -0,0 +1,362 @@
+package bitcoin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/aura-nw/lotus-operator/internal/rpctrace"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+const (
+	defaultCallTimeout = 10
+	defaultRetries     = 2
+	defaultMaxBlockLag = 1
+)
+
+// ErrCallTimeout is returned when bitcoind does not answer within the call timeout.
+var ErrCallTimeout = errors.New("bitcoind call timed out")
+
+// rpcNode is one bitcoind the verifier can query.
+type rpcNode struct {
+	host    string
+	connCfg rpcclient.ConnConfig
+	// proxy carries the requests when they go through a transport
+	proxy *rpctrace.Proxy
+
+	mu     sync.Mutex
+	client *rpcclient.Client
+}
+
+// newRPCNode connects to the bitcoind at host. rpcclient builds its own http
+// client, so a non-nil transport is served on a local proxy the client is
+// pointed at instead.
+func newRPCNode(host string, info config.BitcoinInfo, transport http.RoundTripper) (*rpcNode, error) {
+	connCfg := rpcclient.ConnConfig{
+		Host:         host,
+		User:         info.User,
+		Pass:         info.Pass,
+		CookiePath:   info.CookieFile,
+		DisableTLS:   !info.TLS,
+		HTTPPostMode: true,
+	}
+	if info.CACert != "" {
+		pem, err := os.ReadFile(info.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read bitcoin ca cert: %w", err)
+		}
+		connCfg.Certificates = pem
+	}
+	n := &rpcNode{host: host, connCfg: connCfg}
+	if transport != nil {
+		if info.CACert != "" {
+			return nil, fmt.Errorf("bitcoin ca-cert is not supported with an rpc transport")
+		}
+		scheme := "http://"
+		if info.TLS {
+			scheme = "https://"
+		}
+		proxy, err := rpctrace.NewProxy(scheme+host, transport)
+		if err != nil {
+			return nil, err
+		}
+		n.proxy = proxy
+		n.connCfg.Host = proxy.Addr()
+		n.connCfg.DisableTLS = true
+	}
+	if err := n.reconnect(); err != nil {
+		n.close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *rpcNode) get() *rpcclient.Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.client
+}
+
+// reconnect replaces the client of the node. rpcclient sends the requests of
+// a client one at a time, so a hung request would block every later call.
+func (n *rpcNode) reconnect() error {
+	connCfg := n.connCfg
+	client, err := rpcclient.New(&connCfg, nil)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	old := n.client
+	n.client = client
+	n.mu.Unlock()
+	if old != nil {
+		old.Shutdown()
+	}
+	return nil
+}
+
+// close shuts the client and proxy of the node down.
+func (n *rpcNode) close() {
+	if client := n.get(); client != nil {
+		client.Shutdown()
+	}
+	if n.proxy != nil {
+		n.proxy.Close()
+	}
+}
+
+// rpcPool sends calls to one bitcoind at a time and fails over to the next
+// host when it does not answer.
+type rpcPool struct {
+	logger      *slog.Logger
+	nodes       []*rpcNode
+	timeout     time.Duration
+	retries     int
+	maxBlockLag int64
+
+	mu     sync.Mutex
+	active int
+}
+
+func newRPCPool(logger *slog.Logger, info config.BitcoinInfo, transport http.RoundTripper) (*rpcPool, error) {
+	timeout := info.CallTimeout
+	if timeout == 0 {
+		timeout = defaultCallTimeout
+	}
+	retries := int64(defaultRetries)
+	if info.Retries != nil {
+		retries = *info.Retries
+	}
+	maxBlockLag := info.MaxBlockLag
+	if maxBlockLag == 0 {
+		maxBlockLag = defaultMaxBlockLag
+	}
+
+	p := &rpcPool{
+		logger:      logger,
+		timeout:     time.Duration(timeout) * time.Second,
+		retries:     int(retries),
+		maxBlockLag: maxBlockLag,
+	}
+	for _, host := range append([]string{info.Host}, info.BackupHosts...) {
+		node, err := newRPCNode(host, info, transport)
+		if err != nil {
+			p.shutdown()
+			return nil, err
+		}
+		p.nodes = append(p.nodes, node)
+	}
+	return p, nil
+}
+
+func (p *rpcPool) current() *rpcNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.nodes[p.active]
+}
+
+func (p *rpcPool) use(node *rpcNode, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, n := range p.nodes {
+		if n == node && i != p.active {
+			p.logger.Warn("switching bitcoind host", "from", p.nodes[p.active].host, "to", node.host, "reason", reason)
+			metrics.RPCFailovers.WithLabelValues(metrics.ChainBitcoin).Inc()
+			p.active = i
+		}
+	}
+}
+
+// failover moves off node after it failed, unless another call already did.
+func (p *rpcPool) failover(node *rpcNode, err error) {
+	if errors.Is(err, ErrCallTimeout) {
+		if err := node.reconnect(); err != nil {
+			p.logger.Error("reconnect bitcoind error", "host", node.host, "err", err)
+		}
+	}
+	p.mu.Lock()
+	next := p.nodes[p.active]
+	if next == node {
+		next = p.nodes[(p.active+1)%len(p.nodes)]
+	}
+	p.mu.Unlock()
+	p.use(next, err.Error())
+}
+
+// rpcCall runs fn on the active node, retrying on the next node when the
+// node is unreachable or times out. Errors returned by bitcoind itself are not
+// retried, and neither are calls cancelled by ctx.
+func rpcCall[T any](ctx context.Context, p *rpcPool, method string, fn func(*rpcclient.Client) (T, error)) (result T, err error) {
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		node := p.current()
+		result, err = callNode(ctx, node, p.timeout, fn)
+		var rpcErr *btcjson.RPCError
+		if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+			return result, err
+		}
+		p.logger.Warn("bitcoind call failed", "method", method, "host", node.host, "attempt", attempt+1, "err", err)
+		p.failover(node, err)
+	}
+	return result, err
+}
+
+// callNode runs fn on node until it answers, timeout passes or ctx is done.
+// rpcclient takes no context, so an abandoned request is left to finish in
+// the background.
+func callNode[T any](ctx context.Context, node *rpcNode, timeout time.Duration, fn func(*rpcclient.Client) (T, error)) (T, error) {
+	type response struct {
+		result T
+		err    error
+	}
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	client := node.get()
+	done := make(chan response, 1)
+	go func() {
+		result, err := fn(client)
+		done <- response{result, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-timer.C:
+		return zero, fmt.Errorf("%w after %s on %s", ErrCallTimeout, timeout, node.host)
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// checkBestBlock cross-checks the chain tips of all nodes, so one lagging or
+// lying node cannot make us approve a deposit. The nodes must agree on the
+// block at their lowest common height. The confirmed tip is the highest one
+// at least two nodes reach: a taller tip claimed by a single node is never
+// trusted. The active node may lag the confirmed tip by at most maxBlockLag
+// blocks, otherwise the pool switches to a node at the confirmed tip. It
+// returns the reachable nodes, nil without backup hosts. When a single node
+// is reachable the pool fails over to it, without cross-checks.
+func (p *rpcPool) checkBestBlock(ctx context.Context) ([]*rpcNode, error) {
+	if len(p.nodes) == 1 {
+		return nil, nil
+	}
+
+	heights := make(map[*rpcNode]int64, len(p.nodes))
+	var reachable []*rpcNode
+	for _, node := range p.nodes {
+		height, err := callNode(ctx, node, p.timeout, (*rpcclient.Client).GetBlockCount)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			p.logger.Warn("get bitcoind best block error", "host", node.host, "err", err)
+			continue
+		}
+		heights[node] = height
+		reachable = append(reachable, node)
+	}
+	switch len(reachable) {
+	case 0:
+		return nil, fmt.Errorf("cross-check best block: none of %d bitcoind hosts reachable", len(p.nodes))
+	case 1:
+		p.logger.Warn("single bitcoind host reachable, deposits are not cross-checked", "host", reachable[0].host)
+		p.use(reachable[0], "only reachable host")
+		return reachable, nil
+	}
+
+	common := heights[reachable[0]]
+	for _, node := range reachable {
+		common = min(common, heights[node])
+	}
+
+	var first *rpcNode
+	var hash *chainhash.Hash
+	for _, node := range reachable {
+		nodeHash, err := callNode(ctx, node, p.timeout, func(c *rpcclient.Client) (*chainhash.Hash, error) {
+			return c.GetBlockHash(common)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cross-check best block: %s: %w", node.host, err)
+		}
+		if hash == nil {
+			first, hash = node, nodeHash
+			continue
+		}
+		if !nodeHash.IsEqual(hash) {
+			return nil, fmt.Errorf("cross-check best block: %s and %s disagree on block %d: %s != %s",
+				first.host, node.host, common, hash, nodeHash)
+		}
+	}
+
+	ranked := slices.Clone(reachable)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return heights[ranked[i]] > heights[ranked[j]]
+	})
+	confirmed := heights[ranked[1]]
+	target := ranked[1]
+	if heights[ranked[0]] == confirmed {
+		target = ranked[0]
+	}
+
+	active := p.current()
+	height, ok := heights[active]
+	if !ok {
+		p.use(target, "unreachable")
+	} else if confirmed-height > p.maxBlockLag {
+		p.use(target, fmt.Sprintf("lags confirmed tip by %d", confirmed-height))
+	}
+	return reachable, nil
+}
+
+// crossCheckTx asks the reachable nodes other than the active one for the
+// transaction txHash the active node reports in blockHash, so a single node
+// can neither make up a confirmed transaction nor inflate its
+// confirmations. The first node that answers must hold the same
+// transaction in the same block. It returns confirmations capped by those
+// of that node.
+func (p *rpcPool) crossCheckTx(ctx context.Context, reachable []*rpcNode, txHash *chainhash.Hash, blockHash string, confirmations int64) (int64, error) {
+	active := p.current()
+	for _, node := range reachable {
+		if node == active {
+			continue
+		}
+		raw, err := callNode(ctx, node, p.timeout, func(c *rpcclient.Client) (*btcjson.TxRawResult, error) {
+			return c.GetRawTransactionVerbose(txHash)
+		})
+		var rpcErr *btcjson.RPCError
+		if err != nil && !errors.As(err, &rpcErr) {
+			p.logger.Warn("cross-check tx error", "host", node.host, "err", err)
+			continue
+		}
+		if err != nil || raw.Confirmations == 0 || raw.BlockHash != blockHash {
+			return 0, fmt.Errorf("cross-check tx: %s reports tx %s in block %s that is not on the chain of %s",
+				active.host, txHash, blockHash, node.host)
+		}
+		if _, err := decodeRawTx(raw, txHash); err != nil {
+			return 0, fmt.Errorf("cross-check tx on %s: %w", node.host, err)
+		}
+		return min(confirmations, int64(raw.Confirmations)), nil
+	}
+	return 0, fmt.Errorf("cross-check tx %s: no other bitcoind host answered", txHash)
+}
+
+func (p *rpcPool) shutdown() {
+	for _, node := range p.nodes {
+		node.close()
+	}
+}
@@ -0,0 +1,237 @@
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode answers bitcoind JSON-RPC calls from a method to result map.
+type fakeNode struct {
+	results map[string]any
+	auth    string
+	delay   time.Duration
+	calls   atomic.Int64
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Id     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n.auth != "" {
+		user, pass, _ := r.BasicAuth()
+		if user+":"+pass != n.auth {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	n.calls.Add(1)
+	time.Sleep(n.delay)
+	json.NewEncoder(w).Encode(map[string]any{"id": req.Id, "result": n.results[req.Method], "error": nil})
+}
+
+func hostOf(server *httptest.Server) string {
+	return strings.TrimPrefix(strings.TrimPrefix(server.URL, "http://"), "https://")
+}
+
+func newTestPool(t *testing.T, info config.BitcoinInfo, servers ...*httptest.Server) *rpcPool {
+	info.Host = hostOf(servers[0])
+	for _, server := range servers[1:] {
+		info.BackupHosts = append(info.BackupHosts, hostOf(server))
+	}
+	p, err := newRPCPool(slog.Default(), info, nil)
+	require.NoError(t, err)
+	t.Cleanup(p.shutdown)
+	return p
+}
+
+func TestRPCFailover(t *testing.T) {
+	hung := &fakeNode{delay: time.Second}
+	backup := &fakeNode{results: map[string]any{"getblockcount": 100}}
+	hungServer, backupServer := httptest.NewServer(hung), httptest.NewServer(backup)
+	defer hungServer.Close()
+	defer backupServer.Close()
+
+	p := newTestPool(t, config.BitcoinInfo{User: "user", Pass: "pass"}, hungServer, backupServer)
+	p.timeout = 100 * time.Millisecond
+
+	height, err := rpcCall(context.Background(), p, "getblockcount", (*rpcclient.Client).GetBlockCount)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), height)
+	require.Equal(t, hostOf(backupServer), p.current().host)
+
+	// Later calls stay on the backup
+	_, err = rpcCall(context.Background(), p, "getblockcount", (*rpcclient.Client).GetBlockCount)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), hung.calls.Load())
+	require.Equal(t, int64(2), backup.calls.Load())
+}
+
+func TestRPCCallCancelled(t *testing.T) {
+	hung := &fakeNode{delay: time.Second}
+	backup := &fakeNode{results: map[string]any{"getblockcount": 100}}
+	hungServer, backupServer := httptest.NewServer(hung), httptest.NewServer(backup)
+	defer hungServer.Close()
+	defer backupServer.Close()
+
+	p := newTestPool(t, config.BitcoinInfo{User: "user", Pass: "pass"}, hungServer, backupServer)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The call returns when ctx is done and does not fail over
+	start := time.Now()
+	_, err := rpcCall(ctx, p, "getblockcount", (*rpcclient.Client).GetBlockCount)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, hostOf(hungServer), p.current().host)
+	require.Zero(t, backup.calls.Load())
+}
+
+func TestRPCCheckBestBlock(t *testing.T) {
+	const hash = "000000000000000000015e1ee9d94c3df2d3f6e4a4c5ee8e4b3a4c0e1f1d2a3b"
+	const otherHash = "000000000000000000025e1ee9d94c3df2d3f6e4a4c5ee8e4b3a4c0e1f1d2a3b"
+	lagging := &fakeNode{results: map[string]any{"getblockcount": 100, "getblockhash": hash}}
+	best := &fakeNode{results: map[string]any{"getblockcount": 105, "getblockhash": hash}}
+	liar := &fakeNode{results: map[string]any{"getblockcount": 300, "getblockhash": hash}}
+	laggingServer, bestServer, liarServer := httptest.NewServer(lagging), httptest.NewServer(best), httptest.NewServer(liar)
+	defer laggingServer.Close()
+	defer bestServer.Close()
+	defer liarServer.Close()
+
+	// The pool switches to the confirmed tip, not to the tip only the liar claims
+	p := newTestPool(t, config.BitcoinInfo{User: "user", Pass: "pass", MaxBlockLag: 2}, laggingServer, bestServer, liarServer)
+	reachable, err := p.checkBestBlock(context.Background())
+	require.NoError(t, err)
+	require.Len(t, reachable, 3)
+	require.Equal(t, hostOf(bestServer), p.current().host)
+
+	// A node on another chain fails the check
+	liar.results["getblockhash"] = otherHash
+	_, err = p.checkBestBlock(context.Background())
+	require.ErrorContains(t, err, "disagree on block 100")
+
+	// A single reachable node is failed over to without cross-checks
+	bestServer.Close()
+	liarServer.Close()
+	p.timeout = 100 * time.Millisecond
+	reachable, err = p.checkBestBlock(context.Background())
+	require.NoError(t, err)
+	require.Len(t, reachable, 1)
+	require.Equal(t, hostOf(laggingServer), p.current().host)
+}
+
+// rawTx returns a tx paying value and its hex.
+func rawTx(t *testing.T, value int64) (*wire.MsgTx, string) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+	var raw bytes.Buffer
+	require.NoError(t, tx.Serialize(&raw))
+	return tx, hex.EncodeToString(raw.Bytes())
+}
+
+func TestBitcoindCrossCheckTx(t *testing.T) {
+	const hash = "000000000000000000015e1ee9d94c3df2d3f6e4a4c5ee8e4b3a4c0e1f1d2a3b"
+	const otherHash = "00000000000000000002a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+	tx, txHex := rawTx(t, 1000)
+	txHash := tx.TxHash()
+	rawResult := func(hex, blockHash string, confirmations int) map[string]any {
+		return map[string]any{
+			"hex": hex, "txid": txHash.String(), "confirmations": confirmations, "blockhash": blockHash,
+			// Outputs reported by the node are ignored, the hex is decoded
+			"vout": []any{map[string]any{"value": 21, "n": 0, "scriptPubKey": map[string]any{"hex": "51"}}},
+		}
+	}
+	results := func() map[string]any {
+		return map[string]any{
+			"getblockcount":     100,
+			"getblockhash":      hash,
+			"getrawtransaction": rawResult(txHex, hash, 50),
+		}
+	}
+	active, witness := &fakeNode{results: results()}, &fakeNode{results: results()}
+	witness.results["getrawtransaction"] = rawResult(txHex, hash, 3)
+	activeServer, witnessServer := httptest.NewServer(active), httptest.NewServer(witness)
+	defer activeServer.Close()
+	defer witnessServer.Close()
+
+	p := newTestPool(t, config.BitcoinInfo{User: "user", Pass: "pass"}, activeServer, witnessServer)
+	backend := &bitcoindBackend{rpc: p}
+
+	// The confirmations are capped by the witness
+	got, err := backend.GetTransaction(context.Background(), &txHash)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), got.Confirmations)
+	require.Equal(t, []TxOutput{{Value: 1000, PkScript: []byte{0x51}}}, got.Outputs)
+
+	// A tx the witness has in another block is rejected
+	witness.results["getrawtransaction"] = rawResult(txHex, otherHash, 3)
+	_, err = backend.GetTransaction(context.Background(), &txHash)
+	require.ErrorContains(t, err, "not on the chain of "+hostOf(witnessServer))
+
+	// So is a tx the witness does not have in a block
+	witness.results["getrawtransaction"] = rawResult(txHex, "", 0)
+	_, err = backend.GetTransaction(context.Background(), &txHash)
+	require.ErrorContains(t, err, "not on the chain of "+hostOf(witnessServer))
+
+	// And a node answering with another tx
+	_, otherHex := rawTx(t, 2000)
+	active.results["getrawtransaction"] = rawResult(otherHex, hash, 50)
+	_, err = backend.GetTransaction(context.Background(), &txHash)
+	require.ErrorContains(t, err, "bitcoind returned tx")
+}
+
+func TestRPCNoRetries(t *testing.T) {
+	hung := &fakeNode{delay: time.Second}
+	backup := &fakeNode{results: map[string]any{"getblockcount": 100}}
+	hungServer, backupServer := httptest.NewServer(hung), httptest.NewServer(backup)
+	defer hungServer.Close()
+	defer backupServer.Close()
+
+	retries := int64(0)
+	p := newTestPool(t, config.BitcoinInfo{User: "user", Pass: "pass", Retries: &retries}, hungServer, backupServer)
+	p.timeout = 100 * time.Millisecond
+	_, err := rpcCall(context.Background(), p, "getblockcount", (*rpcclient.Client).GetBlockCount)
+	require.ErrorIs(t, err, ErrCallTimeout)
+	require.Zero(t, backup.calls.Load())
+}
+
+func TestRPCTLSCookieAuth(t *testing.T) {
+	node := &fakeNode{results: map[string]any{"getblockcount": 7}, auth: "__cookie__:secret"}
+	server := httptest.NewTLSServer(node)
+	defer server.Close()
+
+	dir := t.TempDir()
+	caCert := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caCert, cert, 0o600))
+	cookie := filepath.Join(dir, ".cookie")
+	require.NoError(t, os.WriteFile(cookie, []byte("__cookie__:secret"), 0o600))
+
+	p := newTestPool(t, config.BitcoinInfo{TLS: true, CACert: caCert, CookieFile: cookie}, server)
+	height, err := rpcCall(context.Background(), p, "getblockcount", (*rpcclient.Client).GetBlockCount)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), height)
+}
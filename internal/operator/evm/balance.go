@@ -0,0 +1,180 @@
+package evm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+)
+
+const (
+	defaultBalanceCheckInterval = 60
+	defaultVoteGasLimit         = 300000
+)
+
+// ErrInsufficientFunds is returned when the operator balance cannot cover a vote.
+var ErrInsufficientFunds = errors.New("insufficient funds to send vote")
+
+// BalanceSource is the part of Sender the balance monitor depends on.
+type BalanceSource interface {
+	GetBalance(ctx context.Context) (*big.Int, error)
+	GetGasPrice(ctx context.Context) (*big.Int, error)
+}
+
+// BalanceInfo is a snapshot of the operator account funding.
+type BalanceInfo struct {
+	Balance        *big.Int  `json:"balance"`
+	GasPrice       *big.Int  `json:"gas_price"`
+	VoteCost       *big.Int  `json:"vote_cost"`
+	VotesRemaining uint64    `json:"votes_remaining"`
+	Low            bool      `json:"low"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// BalanceMonitor periodically checks the operator account balance, warns
+// when it drops under the configured threshold and estimates how many votes
+// it can still pay for.
+type BalanceMonitor struct {
+	logger *slog.Logger
+	source BalanceSource
+
+	mu           sync.RWMutex
+	interval     time.Duration
+	threshold    *big.Int
+	voteGasLimit uint64
+	info         BalanceInfo
+}
+
+func NewBalanceMonitor(logger *slog.Logger, info config.EvmInfo, source BalanceSource) (*BalanceMonitor, error) {
+	m := &BalanceMonitor{
+		logger: logger,
+		source: source,
+	}
+	if err := m.UpdateConfig(info); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UpdateConfig applies the balance monitor fields of info.
+func (m *BalanceMonitor) UpdateConfig(info config.EvmInfo) error {
+	interval := info.BalanceCheckInterval
+	if interval <= 0 {
+		interval = defaultBalanceCheckInterval
+	}
+	voteGasLimit := info.VoteGasLimit
+	if voteGasLimit == 0 {
+		voteGasLimit = defaultVoteGasLimit
+	}
+	threshold := new(big.Int)
+	if info.LowBalanceThreshold != "" {
+		if _, ok := threshold.SetString(info.LowBalanceThreshold, 10); !ok {
+			return fmt.Errorf("invalid low balance threshold: %s", info.LowBalanceThreshold)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interval = time.Duration(interval) * time.Second
+	m.threshold = threshold
+	m.voteGasLimit = voteGasLimit
+	return nil
+}
+
+func (m *BalanceMonitor) checkInterval() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.interval
+}
+
+// Run checks the balance every interval until ctx is done.
+func (m *BalanceMonitor) Run(ctx context.Context) {
+	interval := m.checkInterval()
+	m.logger.Info("starting balance monitor", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Check(ctx); err != nil {
+			m.logger.Error("check evm balance error", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if next := m.checkInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
+	}
+}
+
+// Check refreshes the balance snapshot.
+func (m *BalanceMonitor) Check(ctx context.Context) error {
+	balance, err := m.source.GetBalance(ctx)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := m.source.GetGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	voteGasLimit, threshold := m.voteGasLimit, m.threshold
+	m.mu.RUnlock()
+
+	voteCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(voteGasLimit))
+	var votesRemaining uint64
+	if voteCost.Sign() > 0 {
+		votesRemaining = new(big.Int).Div(balance, voteCost).Uint64()
+	}
+	info := BalanceInfo{
+		Balance:        balance,
+		GasPrice:       gasPrice,
+		VoteCost:       voteCost,
+		VotesRemaining: votesRemaining,
+		Low:            balance.Cmp(threshold) < 0,
+		UpdatedAt:      time.Now(),
+	}
+
+	balanceFloat, _ := new(big.Float).SetInt(balance).Float64()
+	metrics.EvmBalance.Set(balanceFloat)
+	metrics.EvmVotesRemaining.Set(float64(votesRemaining))
+	if info.Low {
+		m.logger.Warn("evm balance under threshold", "balance", balance, "threshold", threshold, "votes_remaining", votesRemaining)
+	}
+
+	m.mu.Lock()
+	m.info = info
+	m.mu.Unlock()
+	return nil
+}
+
+// Info returns the last balance snapshot.
+func (m *BalanceMonitor) Info() BalanceInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.info
+}
+
+// CanAffordVote reports whether the last known balance covers one vote. It
+// returns ErrInsufficientFunds when it does not; an unknown balance is
+// assumed sufficient so a failing RPC never blocks voting.
+func (m *BalanceMonitor) CanAffordVote() error {
+	info := m.Info()
+	if info.Balance == nil || info.VoteCost == nil {
+		return nil
+	}
+	if info.Balance.Cmp(info.VoteCost) < 0 {
+		return fmt.Errorf("%w: balance %s, vote cost %s", ErrInsufficientFunds, info.Balance, info.VoteCost)
+	}
+	return nil
+}
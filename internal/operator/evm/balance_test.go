@@ -0,0 +1,59 @@
+package evm_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBalanceSource struct {
+	balance  *big.Int
+	gasPrice *big.Int
+	err      error
+}
+
+func (s *fakeBalanceSource) GetBalance(context.Context) (*big.Int, error)  { return s.balance, s.err }
+func (s *fakeBalanceSource) GetGasPrice(context.Context) (*big.Int, error) { return s.gasPrice, s.err }
+
+func TestBalanceMonitor(t *testing.T) {
+	source := &fakeBalanceSource{
+		balance:  big.NewInt(1_000_000),
+		gasPrice: big.NewInt(10),
+	}
+	info := config.EvmInfo{
+		LowBalanceThreshold: "2000000",
+		VoteGasLimit:        30_000,
+	}
+	monitor, err := evm.NewBalanceMonitor(slog.Default(), info, source)
+	require.NoError(t, err)
+
+	// Unknown balance never blocks voting
+	require.NoError(t, monitor.CanAffordVote())
+
+	require.NoError(t, monitor.Check(context.Background()))
+	balance := monitor.Info()
+	require.Equal(t, big.NewInt(300_000), balance.VoteCost)
+	require.Equal(t, uint64(3), balance.VotesRemaining)
+	require.True(t, balance.Low)
+	require.NoError(t, monitor.CanAffordVote())
+
+	source.balance = big.NewInt(100_000)
+	require.NoError(t, monitor.Check(context.Background()))
+	require.ErrorIs(t, monitor.CanAffordVote(), evm.ErrInsufficientFunds)
+
+	// A failed check keeps the last snapshot
+	source.err = errors.New("rpc down")
+	require.Error(t, monitor.Check(context.Background()))
+	require.Equal(t, big.NewInt(100_000), monitor.Info().Balance)
+}
+
+func TestBalanceMonitorInvalidThreshold(t *testing.T) {
+	_, err := evm.NewBalanceMonitor(slog.Default(), config.EvmInfo{LowBalanceThreshold: "1eth"}, &fakeBalanceSource{})
+	require.Error(t, err)
+}
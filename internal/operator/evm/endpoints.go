@@ -0,0 +1,277 @@
+package evm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// latencyWeight is the weight of the last call in the endpoint latency average.
+const latencyWeight = 0.2
+
+// ErrNoQuorum is returned when not enough endpoints agree on a quorum read.
+var ErrNoQuorum = errors.New("evm endpoints did not reach quorum")
+
+// EndpointHealth is the health score of one EVM endpoint, served on /status.
+type EndpointHealth struct {
+	Url       string  `json:"url"`
+	Failures  int     `json:"failures"`
+	Latency   float64 `json:"latency_seconds"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// endpoint is one EVM JSON-RPC the verifier can query.
+type endpoint struct {
+	// name is the endpoint url without path and credentials, safe to log
+	name    string
+	client  *ethclient.Client
+	gateway *contracts.Gateway
+	// noFinalized is set once the endpoint rejected the finalized block tag
+	noFinalized atomic.Bool
+
+	mu        sync.Mutex
+	failures  int
+	latency   time.Duration
+	lastError string
+}
+
+// newEndpoint dials rawUrl, sending http requests with transport when it is
+// not nil.
+func newEndpoint(rawUrl string, gatewayAddr common.Address, transport http.RoundTripper) (*endpoint, error) {
+	var opts []rpc.ClientOption
+	if transport != nil {
+		opts = append(opts, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	c, err := rpc.DialOptions(context.Background(), rawUrl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client := ethclient.NewClient(c)
+	gateway, err := contracts.NewGateway(gatewayAddr, client)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{name: endpointName(rawUrl), client: client, gateway: gateway}, nil
+}
+
+// endpointName strips the path, query and credentials of rawUrl, where
+// providers put api keys.
+func endpointName(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "invalid url"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// observe updates the health score of e with the outcome of a call.
+func (e *endpoint) observe(start time.Time, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && !isNodeError(err) {
+		e.failures++
+		e.lastError = err.Error()
+		return
+	}
+	e.failures = 0
+	elapsed := time.Since(start)
+	if e.latency == 0 {
+		e.latency = elapsed
+		return
+	}
+	e.latency = time.Duration((1-latencyWeight)*float64(e.latency) + latencyWeight*float64(elapsed))
+}
+
+// penalize lowers the health score of e after it answered a quorum read
+// differently from the other endpoints.
+func (e *endpoint) penalize(reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures++
+	e.lastError = reason
+}
+
+func (e *endpoint) health() EndpointHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return EndpointHealth{
+		Url:       e.name,
+		Failures:  e.failures,
+		Latency:   e.latency.Seconds(),
+		LastError: e.lastError,
+	}
+}
+
+// isNodeError reports whether err is an answer of the node, such as a
+// revert, rather than a failure to reach it.
+func isNodeError(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+// endpointPool ranks the EVM endpoints by health.
+type endpointPool struct {
+	logger    *slog.Logger
+	endpoints []*endpoint
+}
+
+func newEndpointPool(logger *slog.Logger, urls []string, gatewayAddr common.Address, transport http.RoundTripper) (*endpointPool, error) {
+	p := &endpointPool{logger: logger}
+	for _, rawUrl := range urls {
+		e, err := newEndpoint(rawUrl, gatewayAddr, transport)
+		if err != nil {
+			return nil, err
+		}
+		p.endpoints = append(p.endpoints, e)
+	}
+	return p, nil
+}
+
+// ranked returns the endpoints healthiest first: fewest consecutive failures,
+// then lowest latency. Ties keep the configured order.
+func (p *endpointPool) ranked() []*endpoint {
+	type scored struct {
+		e      *endpoint
+		health EndpointHealth
+	}
+	scores := make([]scored, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		scores = append(scores, scored{e, e.health()})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		a, b := scores[i].health, scores[j].health
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		return a.Latency < b.Latency
+	})
+	ranked := make([]*endpoint, 0, len(scores))
+	for _, s := range scores {
+		ranked = append(ranked, s.e)
+	}
+	return ranked
+}
+
+func (p *endpointPool) best() *endpoint {
+	return p.ranked()[0]
+}
+
+func (p *endpointPool) health() []EndpointHealth {
+	health := make([]EndpointHealth, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		health = append(health, e.health())
+	}
+	return health
+}
+
+// call runs fn on the healthiest endpoint and fails over to the next one when
+// the endpoint cannot be reached or does not answer within timeout. Errors
+// returned by the node itself are not retried, and neither are calls
+// cancelled by ctx, which are not held against the endpoint.
+func call[T any](ctx context.Context, p *endpointPool, method string, timeout time.Duration, fn func(ctx context.Context, e *endpoint) (T, error)) (result T, err error) {
+	for _, e := range p.ranked() {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		start := time.Now()
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err = fn(callCtx, e)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return result, err
+		}
+		e.observe(start, err)
+		if err == nil || isNodeError(err) {
+			return result, err
+		}
+		p.logger.Warn("evm endpoint call failed", "method", method, "url", e.name, "err", err)
+		metrics.RPCFailovers.WithLabelValues(metrics.ChainEvm).Inc()
+	}
+	return result, err
+}
+
+// quorumCall runs fn on every endpoint and returns the answer given by at
+// least quorum of them. fn must read at a pinned block so that honest
+// endpoints give the same answer. Any disagreement is logged and counted, and
+// the endpoints outside the majority are penalized. Each endpoint gets timeout
+// to answer.
+func quorumCall[T any](ctx context.Context, p *endpointPool, method string, quorum int, timeout time.Duration, fn func(ctx context.Context, e *endpoint) (T, error)) (T, error) {
+	type answer struct {
+		e      *endpoint
+		result T
+		key    string
+		err    error
+	}
+	answers := make([]answer, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			callCtx, cancel := context.WithTimeout(ctx, timeout)
+			result, err := fn(callCtx, e)
+			cancel()
+			if err == nil || ctx.Err() == nil {
+				e.observe(start, err)
+			}
+			answers[i] = answer{e: e, result: result, err: err}
+			if err != nil {
+				return
+			}
+			bz, err := json.Marshal(result)
+			answers[i].key, answers[i].err = string(bz), err
+		}(i, e)
+	}
+	wg.Wait()
+
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	votes := make(map[string][]answer)
+	var majority string
+	for _, a := range answers {
+		if a.err != nil {
+			p.logger.Warn("evm endpoint quorum read failed", "method", method, "url", a.e.name, "err", a.err)
+			continue
+		}
+		votes[a.key] = append(votes[a.key], a)
+		if len(votes[a.key]) > len(votes[majority]) {
+			majority = a.key
+		}
+	}
+
+	if len(votes) > 1 {
+		metrics.QuorumDisagreements.WithLabelValues(method).Inc()
+		for key, group := range votes {
+			if key == majority {
+				continue
+			}
+			for _, a := range group {
+				a.e.penalize(fmt.Sprintf("disagreed with quorum on %s", method))
+				p.logger.Error("evm endpoint disagrees with quorum", "method", method, "url", a.e.name, "answer", key, "majority", majority)
+			}
+		}
+	}
+
+	if agreed := len(votes[majority]); agreed < quorum {
+		return zero, fmt.Errorf("%w on %s: %d of %d required endpoints agree", ErrNoQuorum, method, agreed, quorum)
+	}
+	return votes[majority][0].result, nil
+}
@@ -2,17 +2,25 @@ package evm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/aura-nw/lotus-core/clients/evm/contracts"
 	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Verifier interface {
@@ -22,26 +30,33 @@ type Verifier interface {
 
 type Sender interface {
 	GetAddress() common.Address
-	GetOperators() ([]common.Address, error)
+	GetBalance(ctx context.Context) (*big.Int, error)
+	GetGasPrice(ctx context.Context) (*big.Int, error)
+	GetOperators(ctx context.Context) ([]common.Address, error)
 
-	VerifyIncomingInvoice(id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) error
+	VerifyIncomingInvoice(ctx context.Context, id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (common.Hash, error)
 
-	VerifyOutgoingInvoice(id uint64, amount *big.Int, recipient common.Address, signature string) error
+	VerifyOutgoingInvoice(ctx context.Context, id uint64, amount *big.Int, recipient common.Address, signature string) error
 }
 
 type Reader interface {
+	// Chain state
+	GetBlockNumber(ctx context.Context) (uint64, error)
+	GetLatestHeader(ctx context.Context) (*types.Header, error)
+	IsPaused(ctx context.Context) (bool, error)
+
 	// Incoming invoice
-	GetNextIdVerifyIncomingInvoice(operator common.Address) (*big.Int, error)
-	GetIncomingInvoiceCount() (*big.Int, error)
-	GetIncomingInvoice(id uint64) (contracts.IGatewayIncomingInvoiceResponse, error)
+	GetNextIdVerifyIncomingInvoice(ctx context.Context, operator common.Address) (*big.Int, error)
+	GetIncomingInvoiceCount(ctx context.Context) (*big.Int, error)
+	GetIncomingInvoice(ctx context.Context, id uint64) (contracts.IGatewayIncomingInvoiceResponse, error)
 
 	// Outgoing invoice
-	GetNextIdVerifyOutgoingInvoice(operator common.Address) (*big.Int, error)
-	GetOutgoingInvoiceCount() (*big.Int, error)
-	GetOutgoingInvoice(id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error)
-	GetOutgoingTxCount() (*big.Int, error)
-	GetOutgoingTx(id *big.Int) (contracts.IGatewayOutgoingTxInfo, error)
-	VerifyOutgoingTx(id uint64, isVerified bool, signature string) error
+	GetNextIdVerifyOutgoingInvoice(ctx context.Context, operator common.Address) (*big.Int, error)
+	GetOutgoingInvoiceCount(ctx context.Context) (*big.Int, error)
+	GetOutgoingInvoice(ctx context.Context, id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error)
+	GetOutgoingTxCount(ctx context.Context) (*big.Int, error)
+	GetOutgoingTx(ctx context.Context, id *big.Int) (contracts.IGatewayOutgoingTxInfo, error)
+	VerifyOutgoingTx(ctx context.Context, id uint64, isVerified bool, signature string) (common.Hash, error)
 }
 
 type InvoiceStatus uint8
@@ -56,20 +71,30 @@ const (
 	Paid
 )
 
+type logAttrsKey struct{}
+
+// WithLogAttrs returns ctx with the slog attributes args, which the log lines
+// of calls made within ctx carry, such as the invoice a vote is sent for.
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, logAttrsKey{}, args)
+}
+
 type verifierImpl struct {
-	logger          *slog.Logger
-	info            config.EvmInfo
-	client          *ethclient.Client
-	auth            *bind.TransactOpts
-	gatewayContract *contracts.Gateway
+	logger    *slog.Logger
+	mu        sync.RWMutex
+	info      config.EvmInfo
+	endpoints *endpointPool
+	auth      *bind.TransactOpts
 }
 
 func NewVerifier(logger *slog.Logger, info config.EvmInfo) (Verifier, error) {
-	client, err := ethclient.Dial(info.Url)
-	if err != nil {
-		return nil, err
-	}
+	return NewVerifierWithTransport(logger, info, nil)
+}
 
+// NewVerifierWithTransport returns a verifier sending the http requests of
+// its endpoints with transport, such as an rpctrace recorder. Websocket
+// endpoints do not use it.
+func NewVerifierWithTransport(logger *slog.Logger, info config.EvmInfo, transport http.RoundTripper) (Verifier, error) {
 	privateKey, err := crypto.HexToECDSA(info.PrivateKey)
 	if err != nil {
 		return nil, err
@@ -80,40 +105,225 @@ func NewVerifier(logger *slog.Logger, info config.EvmInfo) (Verifier, error) {
 		return nil, err
 	}
 
-	gatewayContract, err := contracts.NewGateway(common.HexToAddress(info.Contracts.GatewayAddr), client)
+	urls := append([]string{info.Url}, info.BackupUrls...)
+	endpoints, err := newEndpointPool(logger, urls, common.HexToAddress(info.Contracts.GatewayAddr), transport)
 	if err != nil {
 		return nil, err
 	}
 
 	return &verifierImpl{
-		logger:          logger,
-		info:            info,
-		client:          client,
-		auth:            auth,
-		gatewayContract: gatewayContract,
+		logger:    logger,
+		info:      info,
+		endpoints: endpoints,
+		auth:      auth,
 	}, nil
 }
 
 var _ Verifier = &verifierImpl{}
 
+// UpdateConfig applies the live fields of info, see config.Diff.
+func (v *verifierImpl) UpdateConfig(info config.EvmInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.info = info
+}
+
+// ctxLogger returns the logger of calls made within ctx, see WithLogAttrs.
+func (v *verifierImpl) ctxLogger(ctx context.Context) *slog.Logger {
+	if args, ok := ctx.Value(logAttrsKey{}).([]any); ok {
+		return v.logger.With(args...)
+	}
+	return v.logger
+}
+
+func (v *verifierImpl) callTimeout() time.Duration {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Duration(v.info.CallTimeout) * time.Second
+}
+
+func (v *verifierImpl) quorum() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return int(v.info.Quorum)
+}
+
+// Endpoints returns the health score of each EVM endpoint.
+func (v *verifierImpl) Endpoints() []EndpointHealth {
+	return v.endpoints.health()
+}
+
+func (v *verifierImpl) minConfirmations() uint64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return uint64(v.info.MinConfirmations)
+}
+
+// gatewayRead runs fn on the healthiest endpoint at its confirmed block, see
+// confirmedBlock.
+func gatewayRead[T any](ctx context.Context, v *verifierImpl, method string, fn func(gateway *contracts.Gateway, opts *bind.CallOpts) (T, error)) (T, error) {
+	return call(ctx, v.endpoints, method, v.callTimeout(), func(ctx context.Context, e *endpoint) (T, error) {
+		block, err := v.confirmedBlock(ctx, e)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return fn(e.gateway, &bind.CallOpts{Context: ctx, BlockNumber: block})
+	})
+}
+
+// criticalRead is gatewayRead, but answered by every endpoint at a pinned
+// block when evm.quorum is above one, see quorumCall.
+func criticalRead[T any](ctx context.Context, v *verifierImpl, method string, fn func(gateway *contracts.Gateway, opts *bind.CallOpts) (T, error)) (T, error) {
+	quorum := v.quorum()
+	if quorum <= 1 {
+		return gatewayRead(ctx, v, method, fn)
+	}
+
+	block, err := v.pinnedBlock(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return quorumCall(ctx, v.endpoints, method, quorum, v.callTimeout(), func(ctx context.Context, e *endpoint) (T, error) {
+		return fn(e.gateway, &bind.CallOpts{Context: ctx, BlockNumber: block})
+	})
+}
+
+// pinnedBlock returns the lowest confirmed block of the reachable endpoints,
+// a block all of them can serve.
+func (v *verifierImpl) pinnedBlock(ctx context.Context) (*big.Int, error) {
+	var block *big.Int
+	for _, e := range v.endpoints.endpoints {
+		callCtx, cancel := context.WithTimeout(ctx, v.callTimeout())
+		confirmed, err := v.confirmedBlock(callCtx, e)
+		cancel()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			v.logger.Warn("get evm endpoint confirmed block error", "url", e.name, "err", err)
+			continue
+		}
+		if block == nil || confirmed.Cmp(block) < 0 {
+			block = confirmed
+		}
+	}
+	if block == nil {
+		return nil, fmt.Errorf("pin block: no evm endpoint reachable")
+	}
+	return block, nil
+}
+
+// confirmedBlock returns the block gateway reads on e are pinned to, so the
+// operator never acts on state an EVM reorg can undo: the finalized block when
+// e supports the finalized tag, otherwise the head minus min-confirmations.
+func (v *verifierImpl) confirmedBlock(ctx context.Context, e *endpoint) (*big.Int, error) {
+	if !e.noFinalized.Load() {
+		header, err := e.client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+		if err == nil {
+			return header.Number, nil
+		}
+		if !isNodeError(err) && !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		v.logger.Info("evm endpoint does not support the finalized tag, using min-confirmations", "url", e.name, "err", err)
+		e.noFinalized.Store(true)
+	}
+
+	head, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	minConfirmations := v.minConfirmations()
+	if head < minConfirmations {
+		return nil, fmt.Errorf("head %d has fewer than %d confirmations", head, minConfirmations)
+	}
+	return new(big.Int).SetUint64(head - minConfirmations), nil
+}
+
+// maxGasPrice returns the configured gas price cap, nil when uncapped.
+func (v *verifierImpl) maxGasPrice() *big.Int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	maxGasPrice, ok := new(big.Int).SetString(v.info.MaxGasPrice, 10)
+	if !ok {
+		return nil
+	}
+	return maxGasPrice
+}
+
 // GetAddress implements Verifier.
 func (v *verifierImpl) GetAddress() common.Address {
 	return v.auth.From
 }
 
+// GetBlockNumber implements Verifier.
+func (v *verifierImpl) GetBlockNumber(ctx context.Context) (height uint64, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "BlockNumber", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.BlockNumber")
+	defer tracing.End(span, &err)
+	return call(ctx, v.endpoints, "BlockNumber", v.callTimeout(), func(ctx context.Context, e *endpoint) (uint64, error) {
+		return e.client.BlockNumber(ctx)
+	})
+}
+
+// GetLatestHeader implements Verifier.
+func (v *verifierImpl) GetLatestHeader(ctx context.Context) (header *types.Header, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "HeaderByNumber", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.HeaderByNumber")
+	defer tracing.End(span, &err)
+	return call(ctx, v.endpoints, "HeaderByNumber", v.callTimeout(), func(ctx context.Context, e *endpoint) (*types.Header, error) {
+		return e.client.HeaderByNumber(ctx, nil)
+	})
+}
+
+// GetBalance implements Verifier.
+func (v *verifierImpl) GetBalance(ctx context.Context) (balance *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "BalanceAt", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.BalanceAt")
+	defer tracing.End(span, &err)
+	return call(ctx, v.endpoints, "BalanceAt", v.callTimeout(), func(ctx context.Context, e *endpoint) (*big.Int, error) {
+		return e.client.BalanceAt(ctx, v.GetAddress(), nil)
+	})
+}
+
+// IsPaused implements Verifier.
+func (v *verifierImpl) IsPaused(ctx context.Context) (paused bool, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "Paused", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.Paused")
+	defer tracing.End(span, &err)
+	return gatewayRead(ctx, v, "Paused", func(gateway *contracts.Gateway, opts *bind.CallOpts) (bool, error) {
+		return gateway.Paused(opts)
+	})
+}
+
 // GetIncomingInvoice implements Verifier.
-func (v *verifierImpl) GetIncomingInvoice(id uint64) (contracts.IGatewayIncomingInvoiceResponse, error) {
-	return v.gatewayContract.IncomingInvoice(&bind.CallOpts{}, fmt.Sprintf("%d", id))
+func (v *verifierImpl) GetIncomingInvoice(ctx context.Context, id uint64) (invoice contracts.IGatewayIncomingInvoiceResponse, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "IncomingInvoice", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.IncomingInvoice")
+	defer tracing.End(span, &err)
+	return criticalRead(ctx, v, "IncomingInvoice", func(gateway *contracts.Gateway, opts *bind.CallOpts) (contracts.IGatewayIncomingInvoiceResponse, error) {
+		return gateway.IncomingInvoice(opts, fmt.Sprintf("%d", id))
+	})
 }
 
 // GetIncomingInvoiceCount implements Verifier.
-func (v *verifierImpl) GetIncomingInvoiceCount() (*big.Int, error) {
-	return v.gatewayContract.IncomingInvoicesCount(&bind.CallOpts{})
+func (v *verifierImpl) GetIncomingInvoiceCount(ctx context.Context) (count *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "IncomingInvoicesCount", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.IncomingInvoicesCount")
+	defer tracing.End(span, &err)
+	return gatewayRead(ctx, v, "IncomingInvoicesCount", func(gateway *contracts.Gateway, opts *bind.CallOpts) (*big.Int, error) {
+		return gateway.IncomingInvoicesCount(opts)
+	})
 }
 
 // GetNextIdVerifyIncomingInvoice implements Verifier.
-func (v *verifierImpl) GetNextIdVerifyIncomingInvoice(operator common.Address) (*big.Int, error) {
-	validatorInfo, err := v.gatewayContract.Validator(&bind.CallOpts{}, v.GetAddress())
+func (v *verifierImpl) GetNextIdVerifyIncomingInvoice(ctx context.Context, operator common.Address) (nextId *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "Validator", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.Validator")
+	defer tracing.End(span, &err)
+	validatorInfo, err := v.getValidator(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -121,104 +331,202 @@ func (v *verifierImpl) GetNextIdVerifyIncomingInvoice(operator common.Address) (
 }
 
 // GetNextIdVerifyOutgoingInvoice implements Verifier.
-func (v *verifierImpl) GetNextIdVerifyOutgoingInvoice(operator common.Address) (*big.Int, error) {
-	validatorInfo, err := v.gatewayContract.Validator(&bind.CallOpts{}, v.GetAddress())
+func (v *verifierImpl) GetNextIdVerifyOutgoingInvoice(ctx context.Context, operator common.Address) (nextId *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "Validator", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.Validator")
+	defer tracing.End(span, &err)
+	validatorInfo, err := v.getValidator(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return validatorInfo.NextOutgoingInvoice, nil
 }
 
+func (v *verifierImpl) getValidator(ctx context.Context) (contracts.IGatewayValidatorInfo, error) {
+	return criticalRead(ctx, v, "Validator", func(gateway *contracts.Gateway, opts *bind.CallOpts) (contracts.IGatewayValidatorInfo, error) {
+		return gateway.Validator(opts, v.GetAddress())
+	})
+}
+
 // GetOutgoingInvoice implements Verifier.
-func (v *verifierImpl) GetOutgoingInvoice(id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
-	panic("unimplemented")
+func (v *verifierImpl) GetOutgoingInvoice(ctx context.Context, id uint64) (invoice contracts.IGatewayOutgoingInvoiceResponse, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "OutgoingInvoice", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.OutgoingInvoice")
+	defer tracing.End(span, &err)
+	return criticalRead(ctx, v, "OutgoingInvoice", func(gateway *contracts.Gateway, opts *bind.CallOpts) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+		return gateway.OutgoingInvoice(opts, new(big.Int).SetUint64(id))
+	})
 }
 
 // GetOutgoingInvoiceCount implements Verifier.
-func (v *verifierImpl) GetOutgoingInvoiceCount() (*big.Int, error) {
-	return v.gatewayContract.OutgoingInvoicesCount(&bind.CallOpts{})
+func (v *verifierImpl) GetOutgoingInvoiceCount(ctx context.Context) (count *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "OutgoingInvoicesCount", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.OutgoingInvoicesCount")
+	defer tracing.End(span, &err)
+	return gatewayRead(ctx, v, "OutgoingInvoicesCount", func(gateway *contracts.Gateway, opts *bind.CallOpts) (*big.Int, error) {
+		return gateway.OutgoingInvoicesCount(opts)
+	})
 }
 
 // GetOutgoingTxCount implements Verifier.
-func (v *verifierImpl) GetOutgoingTxCount() (*big.Int, error) {
-	return v.gatewayContract.OutgoingTxCount(&bind.CallOpts{})
+func (v *verifierImpl) GetOutgoingTxCount(ctx context.Context) (count *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "OutgoingTxCount", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.OutgoingTxCount")
+	defer tracing.End(span, &err)
+	return gatewayRead(ctx, v, "OutgoingTxCount", func(gateway *contracts.Gateway, opts *bind.CallOpts) (*big.Int, error) {
+		return gateway.OutgoingTxCount(opts)
+	})
 }
 
 // GetOutgoingTx implements Verifier.
-func (v *verifierImpl) GetOutgoingTx(id *big.Int) (contracts.IGatewayOutgoingTxInfo, error) {
-	return v.gatewayContract.OutgoingTx(&bind.CallOpts{}, id)
-
+func (v *verifierImpl) GetOutgoingTx(ctx context.Context, id *big.Int) (tx contracts.IGatewayOutgoingTxInfo, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "OutgoingTx", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.OutgoingTx")
+	defer tracing.End(span, &err)
+	return criticalRead(ctx, v, "OutgoingTx", func(gateway *contracts.Gateway, opts *bind.CallOpts) (contracts.IGatewayOutgoingTxInfo, error) {
+		return gateway.OutgoingTx(opts, id)
+	})
 }
 
 // VerifyOutgoingTx implements Verifier.
-func (v *verifierImpl) VerifyOutgoingTx(id uint64, isVerified bool, signature string) error {
-	tx, err := v.gatewayContract.VerifyOutgoingTx(v.auth, big.NewInt(int64(id)), isVerified, signature)
+func (v *verifierImpl) VerifyOutgoingTx(ctx context.Context, id uint64, isVerified bool, signature string) (txHash common.Hash, err error) {
+	ctx, span := tracing.Start(ctx, "evm.VerifyOutgoingTx", attribute.Bool("verified", isVerified))
+	defer tracing.End(span, &err)
+
+	gasPrice, err := v.voteGasPrice(ctx)
 	if err != nil {
-		v.logger.Error("call VerifyOutgoingTx error", "err", err)
-		return err
+		return common.Hash{}, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(v.info.CallTimeout)*time.Second)
-	defer cancel()
-	receipt, err := bind.WaitMined(ctx, v.client, tx)
+	e := v.endpoints.best()
+	sendCtx, cancel := context.WithTimeout(ctx, v.callTimeout())
+	start := time.Now()
+	tx, err := e.gateway.VerifyOutgoingTx(v.transactOpts(sendCtx, gasPrice), big.NewInt(int64(id)), isVerified, signature)
+	cancel()
+	if ctx.Err() == nil {
+		e.observe(start, err)
+	}
 	if err != nil {
-		v.logger.Error("call WaitMined error", "err", err)
-		return err
+		v.ctxLogger(ctx).Error("call VerifyOutgoingTx error", "err", err, "url", e.name)
+		return common.Hash{}, err
 	}
-	v.logger.Info("call WaitMined ok", "tx_hash", receipt.TxHash.Hex())
-	return nil
+	span.SetAttributes(attribute.String("tx_hash", tx.Hash().Hex()))
+	return v.waitMined(ctx, e, tx)
 }
 
 // VerifyIncomingInvoice implements Verifier.
-func (v *verifierImpl) VerifyIncomingInvoice(id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) error {
-	if err := v.updateGasPrice(); err != nil {
-		return err
+func (v *verifierImpl) VerifyIncomingInvoice(ctx context.Context, id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (txHash common.Hash, err error) {
+	ctx, span := tracing.Start(ctx, "evm.VerifyIncomingInvoice", attribute.Bool("verified", isVerified))
+	defer tracing.End(span, &err)
+
+	gasPrice, err := v.voteGasPrice(ctx)
+	if err != nil {
+		return common.Hash{}, err
 	}
 
-	tx, err := v.gatewayContract.VerifyIncomingInvoice(v.auth, big.NewInt(int64(id)), utxo, amount, recipient, isVerified)
+	e := v.endpoints.best()
+	sendCtx, cancel := context.WithTimeout(ctx, v.callTimeout())
+	start := time.Now()
+	tx, err := e.gateway.VerifyIncomingInvoice(v.transactOpts(sendCtx, gasPrice), big.NewInt(int64(id)), utxo, amount, recipient, isVerified)
+	cancel()
+	if ctx.Err() == nil {
+		e.observe(start, err)
+	}
 	if err != nil {
-		v.logger.Error("call VerifyIncomingInvoice error", "err", err)
-		return err
+		v.ctxLogger(ctx).Error("call VerifyIncomingInvoice error", "err", err, "url", e.name)
+		return common.Hash{}, err
 	}
+	span.SetAttributes(attribute.String("tx_hash", tx.Hash().Hex()))
+	return v.waitMined(ctx, e, tx)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(v.info.CallTimeout)*time.Second)
+// waitMined waits for tx, sent through e, to be mined and records its latency
+// and fee.
+func (v *verifierImpl) waitMined(ctx context.Context, e *endpoint, tx *types.Transaction) (txHash common.Hash, err error) {
+	_, span := tracing.Start(ctx, "evm.WaitMined", attribute.String("tx_hash", tx.Hash().Hex()))
+	defer tracing.End(span, &err)
+
+	waitCtx, cancel := context.WithTimeout(ctx, v.callTimeout())
 	defer cancel()
-	receipt, err := bind.WaitMined(ctx, v.client, tx)
+
+	start := time.Now()
+	receipt, err := bind.WaitMined(waitCtx, e.client, tx)
 	if err != nil {
-		v.logger.Error("call WaitMined error", "err", err)
-		return err
+		v.ctxLogger(ctx).Error("call WaitMined error", "err", err)
+		return tx.Hash(), err
+	}
+	metrics.WaitMinedLatency.Observe(time.Since(start).Seconds())
+	metrics.GasUsed.Add(float64(receipt.GasUsed))
+	if receipt.EffectiveGasPrice != nil {
+		fee, _ := new(big.Float).SetInt(new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))).Float64()
+		metrics.FeesPaid.Add(fee)
+	}
+
+	v.ctxLogger(ctx).Info("call WaitMined ok", "tx_hash", receipt.TxHash.Hex())
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt.TxHash, fmt.Errorf("tx %s reverted", receipt.TxHash.Hex())
 	}
-	v.logger.Info("call WaitMined ok", "tx_hash", receipt.TxHash.Hex())
-	return nil
+	return receipt.TxHash, nil
 }
 
 // VerifyOutgoingInvoice implements Verifier.
-func (v *verifierImpl) VerifyOutgoingInvoice(id uint64, amount *big.Int, recipient common.Address, signature string) error {
+func (v *verifierImpl) VerifyOutgoingInvoice(ctx context.Context, id uint64, amount *big.Int, recipient common.Address, signature string) error {
 	panic("unimplemented")
 }
 
-func (v *verifierImpl) updateGasPrice() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(v.info.CallTimeout)*time.Second)
-	defer cancel()
+// GetGasPrice implements Verifier. It returns the gas price the operator bids
+// for its transactions, twice the suggested price capped by max-gas-price.
+func (v *verifierImpl) GetGasPrice(ctx context.Context) (gasPrice *big.Int, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "SuggestGasPrice", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.SuggestGasPrice")
+	defer tracing.End(span, &err)
+	suggested, err := call(ctx, v.endpoints, "SuggestGasPrice", v.callTimeout(), func(ctx context.Context, e *endpoint) (*big.Int, error) {
+		return e.client.SuggestGasPrice(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	gasPrice = new(big.Int).Mul(suggested, big.NewInt(2))
+	if maxGasPrice := v.maxGasPrice(); maxGasPrice != nil && gasPrice.Cmp(maxGasPrice) > 0 {
+		v.ctxLogger(ctx).Warn("gas price capped", "gas", gasPrice, "max_gas_price", maxGasPrice)
+		gasPrice = maxGasPrice
+	}
+	return gasPrice, nil
+}
 
-	gasPrice, err := v.client.SuggestGasPrice(ctx)
+// voteGasPrice returns the gas price of the next vote, see GetGasPrice.
+func (v *verifierImpl) voteGasPrice(ctx context.Context) (*big.Int, error) {
+	gasPrice, err := v.GetGasPrice(ctx)
 	if err != nil {
-		v.logger.Error("suggest gas price error", "err", err)
-		return err
+		v.ctxLogger(ctx).Error("suggest gas price error", "err", err)
+		return nil, err
 	}
-	v.logger.Info("suggest gas price", "gas", gasPrice)
-	v.auth.GasPrice = big.NewInt(gasPrice.Int64() * 2)
-	return nil
+	v.ctxLogger(ctx).Info("suggest gas price", "gas", gasPrice)
+	return gasPrice, nil
+}
+
+// transactOpts returns the options of a transaction sent within ctx, bidding
+// gasPrice. The shared auth is copied so that concurrent transactions do not
+// race on it.
+func (v *verifierImpl) transactOpts(ctx context.Context, gasPrice *big.Int) *bind.TransactOpts {
+	opts := *v.auth
+	opts.Context = ctx
+	opts.GasPrice = gasPrice
+	return &opts
 }
 
 // GetOperators implements Verifier.
-func (v *verifierImpl) GetOperators() ([]common.Address, error) {
-	operatorInfos, err := v.gatewayContract.AllValidators(&bind.CallOpts{})
+func (v *verifierImpl) GetOperators(ctx context.Context) (addrs []common.Address, err error) {
+	defer metrics.ObserveRPC(metrics.ChainEvm, "AllValidators", time.Now(), &err)
+	_, span := tracing.Start(ctx, "evm.AllValidators")
+	defer tracing.End(span, &err)
+	operatorInfos, err := gatewayRead(ctx, v, "AllValidators", func(gateway *contracts.Gateway, opts *bind.CallOpts) ([]contracts.IGatewayValidatorInfo, error) {
+		return gateway.AllValidators(opts)
+	})
 	if err != nil {
 		v.logger.Error("get all operators error", "err", err)
 		return nil, err
 	}
-	var addrs []common.Address
 	for _, info := range operatorInfos {
 		addrs = append(addrs, info.Validator)
 	}
@@ -1,15 +1,23 @@
 package evm_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"log/slog"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/aura-nw/lotus-core/types"
 	"github.com/aura-nw/lotus-operator/config"
 	"github.com/aura-nw/lotus-operator/internal/operator/evm"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/stretchr/testify/require"
 )
@@ -19,6 +27,13 @@ const (
 	evmosTestnetChainId int64 = 1235
 )
 
+// liveTest skips tests hitting the dev network unless LOTUS_LIVE_TESTS is set.
+func liveTest(t *testing.T) {
+	if os.Getenv("LOTUS_LIVE_TESTS") == "" {
+		t.Skip("set LOTUS_LIVE_TESTS to run tests against the dev network")
+	}
+}
+
 func getEvmInfo(privateKey string) config.EvmInfo {
 	return config.EvmInfo{
 		Url:              evmosTestnetRpc,
@@ -36,6 +51,7 @@ func getEvmInfo(privateKey string) config.EvmInfo {
 }
 
 func TestRpc(t *testing.T) {
+	liveTest(t)
 	client, err := ethclient.Dial(evmosTestnetRpc)
 	require.NoError(t, err)
 
@@ -49,29 +65,31 @@ func TestRpc(t *testing.T) {
 }
 
 func TestQueryGateway(t *testing.T) {
+	liveTest(t)
 	priv1 := "883d80012adf2272875981428715c56558eb388dcea4b48e030bd63ddd23c128"
 	verifier, err := evm.NewVerifier(slog.Default(), getEvmInfo(priv1))
 	require.NoError(t, err)
 
 	require.Equal(t, common.HexToAddress("0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A"), verifier.GetAddress())
 
-	count, err := verifier.GetIncomingInvoiceCount()
+	count, err := verifier.GetIncomingInvoiceCount(context.Background())
 	require.NoError(t, err)
 	t.Log("incoming invoice count: ", count)
 
-	nextIdIncoming, err := verifier.GetNextIdVerifyIncomingInvoice(verifier.GetAddress())
+	nextIdIncoming, err := verifier.GetNextIdVerifyIncomingInvoice(context.Background(), verifier.GetAddress())
 	require.NoError(t, err)
 	t.Log("next id incoming: ", nextIdIncoming)
 }
 
 func TestVerify(t *testing.T) {
+	liveTest(t)
 	priv1 := "444a26796811d3b86bd1c3b85d04b9b078e4eee66203096f04081b245d6e4123"
 	verifier, err := evm.NewVerifier(slog.Default(), getEvmInfo(priv1))
 	require.NoError(t, err)
 
 	t.Log("sender address: ", verifier.GetAddress().Hex())
 
-	operators, err := verifier.GetOperators()
+	operators, err := verifier.GetOperators(context.Background())
 	require.NoError(t, err)
 	t.Log("list operators: ", operators)
 
@@ -88,10 +106,98 @@ func TestVerify(t *testing.T) {
 		Status:         "new",
 	}
 
-	count, err := verifier.GetIncomingInvoiceCount()
+	count, err := verifier.GetIncomingInvoiceCount(context.Background())
 	require.NoError(t, err)
 	t.Log("count incoming: ", count)
 
-	err = verifier.VerifyIncomingInvoice(count.Uint64(), testDeposit.TxId, big.NewInt(int64(testDeposit.Amount)), common.HexToAddress(testDeposit.Receiver), true)
+	txHash, err := verifier.VerifyIncomingInvoice(context.Background(), count.Uint64(), testDeposit.TxId, big.NewInt(int64(testDeposit.Amount)), common.HexToAddress(testDeposit.Receiver), true)
+	require.NoError(t, err)
+	t.Log("vote tx hash: ", txHash.Hex())
+}
+
+// gasNode is an EVM node suggesting a gas price of 100 wei. It records the
+// gas price of the transactions sent to it and rejects them.
+type gasNode struct {
+	t    *testing.T
+	sent []*big.Int
+}
+
+func (n *gasNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Id     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	require.NoError(n.t, json.NewDecoder(r.Body).Decode(&req))
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.Id}
+	switch req.Method {
+	case "eth_gasPrice":
+		resp["result"] = hexutil.EncodeBig(big.NewInt(100))
+	case "eth_getTransactionCount", "eth_estimateGas":
+		resp["result"] = hexutil.EncodeUint64(21_000)
+	case "eth_getCode":
+		resp["result"] = "0x60"
+	case "eth_sendRawTransaction":
+		var raw hexutil.Bytes
+		require.NoError(n.t, json.Unmarshal(req.Params[0], &raw))
+		var tx ethtypes.Transaction
+		require.NoError(n.t, tx.UnmarshalBinary(raw))
+		n.sent = append(n.sent, tx.GasPrice())
+		resp["error"] = map[string]any{"code": -32000, "message": "rejected"}
+	default:
+		resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestOutgoingVoteGasPriceCap(t *testing.T) {
+	node := &gasNode{t: t}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	info := getEvmInfo("444a26796811d3b86bd1c3b85d04b9b078e4eee66203096f04081b245d6e4123")
+	info.Url = server.URL
+	info.MaxGasPrice = "150"
+	verifier, err := evm.NewVerifier(slog.Default(), info)
+	require.NoError(t, err)
+
+	// Twice the suggested price is capped, also before any incoming vote
+	_, err = verifier.VerifyOutgoingTx(context.Background(), 1, true, "")
+	require.ErrorContains(t, err, "rejected")
+
+	// A reloaded cap applies to the next vote
+	info.MaxGasPrice = "120"
+	verifier.(interface{ UpdateConfig(config.EvmInfo) }).UpdateConfig(info)
+	_, err = verifier.VerifyOutgoingTx(context.Background(), 1, true, "")
+	require.ErrorContains(t, err, "rejected")
+	require.Equal(t, []*big.Int{big.NewInt(150), big.NewInt(120)}, node.sent)
+}
+
+func TestVoteLogAttrs(t *testing.T) {
+	server := httptest.NewServer(&gasNode{t: t})
+	defer server.Close()
+
+	info := getEvmInfo("444a26796811d3b86bd1c3b85d04b9b078e4eee66203096f04081b245d6e4123")
+	info.Url = server.URL
+	info.MaxGasPrice = "150"
+	var buf bytes.Buffer
+	verifier, err := evm.NewVerifier(slog.New(slog.NewJSONHandler(&buf, nil)), info)
 	require.NoError(t, err)
+	buf.Reset()
+
+	ctx := evm.WithLogAttrs(context.Background(), "invoice_id", 1, "correlation_id", "c0ffee")
+	_, err = verifier.VerifyOutgoingTx(ctx, 1, true, "")
+	require.Error(t, err)
+
+	msgs := make(map[string]bool)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		require.Equal(t, "c0ffee", line["correlation_id"], line["msg"])
+		require.Equal(t, float64(1), line["invoice_id"], line["msg"])
+		msgs[line["msg"].(string)] = true
+	}
+	require.True(t, msgs["gas price capped"])
+	require.True(t, msgs["call VerifyOutgoingTx error"])
 }
@@ -0,0 +1,493 @@
+// Package evmtest provides an in-memory gateway contract for operator tests.
+//
+// The gateway bindings ship without bytecode, so the contract cannot be
+// deployed on a simulated backend. Gateway models the part of its behavior the
+// operator depends on instead: invoice and outgoing tx ids start at 1, every
+// validator votes at most once on each of them, and an invoice or tx leaves
+// the Pending status once threshold validators agree on it.
+package evmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrNotValidator is returned when an address that is not a validator votes.
+	ErrNotValidator = errors.New("evmtest: not a validator")
+	// ErrAlreadyVoted is returned when a validator votes twice on an invoice or tx.
+	ErrAlreadyVoted = errors.New("evmtest: already voted")
+	// ErrNotPending is returned on votes on invoices or txs that are not pending.
+	ErrNotPending = errors.New("evmtest: not pending")
+	// ErrPaused is returned on votes while the gateway is paused.
+	ErrPaused = errors.New("evmtest: gateway paused")
+)
+
+// DefaultBalance is the balance of every validator account.
+var DefaultBalance = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(100))
+
+// Vote is one vote sent to the gateway.
+type Vote struct {
+	Validator common.Address
+	Direction string
+	Id        uint64
+	Verified  bool
+	Signature string
+	TxHash    common.Hash
+}
+
+type incomingInvoice struct {
+	contracts.IGatewayIncomingInvoiceResponse
+	verdicts []bool
+}
+
+type outgoingTx struct {
+	contracts.IGatewayOutgoingTxInfo
+	verdicts []bool
+}
+
+// Gateway is an in-memory gateway contract shared by the operators of a test.
+type Gateway struct {
+	mu               sync.Mutex
+	threshold        int
+	validators       []common.Address
+	nextIncoming     map[common.Address]uint64
+	nextOutgoing     map[common.Address]uint64
+	incoming         []*incomingInvoice
+	outgoingInvoices []contracts.IGatewayOutgoingInvoiceResponse
+	outgoingTxs      []*outgoingTx
+	votes            []Vote
+	paused           bool
+	block            uint64
+	err              error
+}
+
+// NewGateway returns a gateway where threshold of validators must agree on an
+// invoice or tx.
+func NewGateway(threshold int, validators ...common.Address) *Gateway {
+	g := &Gateway{
+		threshold:    threshold,
+		validators:   validators,
+		nextIncoming: make(map[common.Address]uint64),
+		nextOutgoing: make(map[common.Address]uint64),
+		block:        1,
+	}
+	for _, validator := range validators {
+		g.nextIncoming[validator] = 1
+		g.nextOutgoing[validator] = 1
+	}
+	return g
+}
+
+// AddIncomingInvoice creates a pending incoming invoice and returns its id.
+func (g *Gateway) AddIncomingInvoice(utxo string, amount *big.Int, recipient common.Address) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := uint64(len(g.incoming) + 1)
+	g.incoming = append(g.incoming, &incomingInvoice{
+		IGatewayIncomingInvoiceResponse: contracts.IGatewayIncomingInvoiceResponse{
+			InvoiceId:     new(big.Int).SetUint64(id),
+			Utxo:          utxo,
+			Amount:        amount,
+			Recipient:     recipient,
+			Status:        uint8(evm.Pending),
+			Validators:    g.validators,
+			Confirmations: make([]bool, len(g.validators)),
+		},
+		verdicts: make([]bool, len(g.validators)),
+	})
+	g.block++
+	return id
+}
+
+// AddOutgoingInvoice creates a pending withdrawal of amount sats to the
+// bitcoin address recipient and returns its id.
+func (g *Gateway) AddOutgoingInvoice(from common.Address, amount *big.Int, recipient string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := uint64(len(g.outgoingInvoices) + 1)
+	g.outgoingInvoices = append(g.outgoingInvoices, contracts.IGatewayOutgoingInvoiceResponse{
+		InvoiceId: new(big.Int).SetUint64(id),
+		From:      from,
+		Amount:    amount,
+		Recipient: recipient,
+		Status:    uint8(evm.Pending),
+		TxId:      new(big.Int),
+	})
+	g.block++
+	return id
+}
+
+// AddOutgoingTx submits txContent, the hex of a bitcoin tx paying the given
+// outgoing invoices, and returns the tx id.
+func (g *Gateway) AddOutgoingTx(txContent string, invoiceIds ...uint64) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := uint64(len(g.outgoingTxs) + 1)
+	tx := &outgoingTx{
+		IGatewayOutgoingTxInfo: contracts.IGatewayOutgoingTxInfo{
+			TxId:       new(big.Int).SetUint64(id),
+			TxContent:  txContent,
+			Validators: g.validators,
+			Signatures: make([]string, len(g.validators)),
+			Status:     uint8(evm.Pending),
+		},
+		verdicts: make([]bool, len(g.validators)),
+	}
+	for _, invoiceId := range invoiceIds {
+		tx.InvoiceIds = append(tx.InvoiceIds, new(big.Int).SetUint64(invoiceId))
+		if invoiceId >= 1 && invoiceId <= uint64(len(g.outgoingInvoices)) {
+			g.outgoingInvoices[invoiceId-1].TxId = new(big.Int).SetUint64(id)
+		}
+	}
+	g.outgoingTxs = append(g.outgoingTxs, tx)
+	g.block++
+	return id
+}
+
+// SetPaused pauses or unpauses the gateway.
+func (g *Gateway) SetPaused(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = paused
+}
+
+// SetError makes every call fail with err until it is set back to nil.
+func (g *Gateway) SetError(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.err = err
+}
+
+// IncomingInvoice returns the incoming invoice id.
+func (g *Gateway) IncomingInvoice(id uint64) contracts.IGatewayIncomingInvoiceResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.incoming[id-1].copy()
+}
+
+// OutgoingTx returns the outgoing tx id.
+func (g *Gateway) OutgoingTx(id uint64) contracts.IGatewayOutgoingTxInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.outgoingTxs[id-1].copy()
+}
+
+// Votes returns the votes sent so far, in order.
+func (g *Gateway) Votes() []Vote {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Vote(nil), g.votes...)
+}
+
+// Verifier returns the view of the gateway of the validator at address, to
+// use as the evm.Verifier of its operator.
+func (g *Gateway) Verifier(address common.Address) evm.Verifier {
+	return &verifier{gateway: g, address: address}
+}
+
+func (i *incomingInvoice) copy() contracts.IGatewayIncomingInvoiceResponse {
+	invoice := i.IGatewayIncomingInvoiceResponse
+	invoice.Confirmations = append([]bool(nil), i.Confirmations...)
+	return invoice
+}
+
+func (t *outgoingTx) copy() contracts.IGatewayOutgoingTxInfo {
+	tx := t.IGatewayOutgoingTxInfo
+	tx.Signatures = append([]string(nil), t.Signatures...)
+	tx.InvoiceIds = append([]*big.Int(nil), t.InvoiceIds...)
+	return tx
+}
+
+func (g *Gateway) validatorIndex(address common.Address) int {
+	for i, validator := range g.validators {
+		if validator == address {
+			return i
+		}
+	}
+	return -1
+}
+
+// vote checks a vote of address and returns its index among the validators.
+// g.mu must be held.
+func (g *Gateway) vote(address common.Address) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.paused {
+		return 0, ErrPaused
+	}
+	index := g.validatorIndex(address)
+	if index == -1 {
+		return 0, fmt.Errorf("%w: %s", ErrNotValidator, address.Hex())
+	}
+	return index, nil
+}
+
+// tally returns the status after a vote: status when threshold validators
+// verified, rejected when threshold validators did not, Pending otherwise.
+func (g *Gateway) tally(voted []bool, verdicts []bool, status, rejected evm.InvoiceStatus) uint8 {
+	var valid, invalid int
+	for i := range voted {
+		if !voted[i] {
+			continue
+		}
+		if verdicts[i] {
+			valid++
+		} else {
+			invalid++
+		}
+	}
+	switch {
+	case valid >= g.threshold:
+		return uint8(status)
+	case invalid >= g.threshold:
+		return uint8(rejected)
+	default:
+		return uint8(evm.Pending)
+	}
+}
+
+func (g *Gateway) record(vote Vote) common.Hash {
+	g.block++
+	vote.TxHash = crypto.Keccak256Hash([]byte(fmt.Sprintf("%s/%s/%d/%d", vote.Validator.Hex(), vote.Direction, vote.Id, g.block)))
+	g.votes = append(g.votes, vote)
+	return vote.TxHash
+}
+
+func (g *Gateway) verifyIncomingInvoice(address common.Address, id uint64, utxo string, amount *big.Int, recipient common.Address, verified bool) (common.Hash, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	index, err := g.vote(address)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if id < 1 || id > uint64(len(g.incoming)) {
+		return common.Hash{}, fmt.Errorf("evmtest: incoming invoice %d not found", id)
+	}
+	invoice := g.incoming[id-1]
+	if invoice.Utxo != utxo || invoice.Amount.Cmp(amount) != 0 || invoice.Recipient != recipient {
+		return common.Hash{}, fmt.Errorf("evmtest: vote does not match incoming invoice %d", id)
+	}
+	if evm.InvoiceStatus(invoice.Status) != evm.Pending {
+		return common.Hash{}, fmt.Errorf("%w: incoming invoice %d", ErrNotPending, id)
+	}
+	if invoice.Confirmations[index] {
+		return common.Hash{}, fmt.Errorf("%w: incoming invoice %d", ErrAlreadyVoted, id)
+	}
+
+	invoice.Confirmations[index] = true
+	invoice.verdicts[index] = verified
+	invoice.Status = g.tally(invoice.Confirmations, invoice.verdicts, evm.Minted, evm.Refunding)
+	if id >= g.nextIncoming[address] {
+		g.nextIncoming[address] = id + 1
+	}
+	return g.record(Vote{Validator: address, Direction: "incoming", Id: id, Verified: verified}), nil
+}
+
+func (g *Gateway) verifyOutgoingTx(address common.Address, id uint64, verified bool, signature string) (common.Hash, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	index, err := g.vote(address)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if id < 1 || id > uint64(len(g.outgoingTxs)) {
+		return common.Hash{}, fmt.Errorf("evmtest: outgoing tx %d not found", id)
+	}
+	tx := g.outgoingTxs[id-1]
+	if evm.InvoiceStatus(tx.Status) != evm.Pending {
+		return common.Hash{}, fmt.Errorf("%w: outgoing tx %d", ErrNotPending, id)
+	}
+	voted := make([]bool, len(tx.Signatures))
+	for i, s := range tx.Signatures {
+		voted[i] = s != ""
+	}
+	if voted[index] {
+		return common.Hash{}, fmt.Errorf("%w: outgoing tx %d", ErrAlreadyVoted, id)
+	}
+
+	// An empty signature of a rejection still counts as a vote
+	tx.Signatures[index] = signature
+	if signature == "" {
+		tx.Signatures[index] = "-"
+	}
+	voted[index] = true
+	tx.verdicts[index] = verified
+	tx.Status = g.tally(voted, tx.verdicts, evm.Paid, evm.Manual)
+	for _, invoiceId := range tx.InvoiceIds {
+		next := invoiceId.Uint64() + 1
+		if next > g.nextOutgoing[address] {
+			g.nextOutgoing[address] = next
+		}
+		if tx.Status != uint8(evm.Pending) {
+			g.outgoingInvoices[invoiceId.Uint64()-1].Status = tx.Status
+		}
+	}
+	return g.record(Vote{Validator: address, Direction: "outgoing", Id: id, Verified: verified, Signature: signature}), nil
+}
+
+// verifier implements evm.Verifier on a Gateway for one validator.
+type verifier struct {
+	gateway *Gateway
+	address common.Address
+}
+
+// read runs fn with the gateway locked, unless SetError was called.
+func read[T any](g *Gateway, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		var zero T
+		return zero, g.err
+	}
+	return fn()
+}
+
+// GetAddress implements evm.Verifier.
+func (v *verifier) GetAddress() common.Address {
+	return v.address
+}
+
+// GetBalance implements evm.Verifier.
+func (v *verifier) GetBalance(ctx context.Context) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		return new(big.Int).Set(DefaultBalance), nil
+	})
+}
+
+// GetGasPrice implements evm.Verifier.
+func (v *verifier) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		return big.NewInt(1e9), nil
+	})
+}
+
+// GetOperators implements evm.Verifier.
+func (v *verifier) GetOperators(ctx context.Context) ([]common.Address, error) {
+	return read(v.gateway, func() ([]common.Address, error) {
+		return append([]common.Address(nil), v.gateway.validators...), nil
+	})
+}
+
+// VerifyIncomingInvoice implements evm.Verifier.
+func (v *verifier) VerifyIncomingInvoice(ctx context.Context, id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (common.Hash, error) {
+	return v.gateway.verifyIncomingInvoice(v.address, id, utxo, amount, recipient, isVerified)
+}
+
+// VerifyOutgoingInvoice implements evm.Verifier.
+func (v *verifier) VerifyOutgoingInvoice(ctx context.Context, id uint64, amount *big.Int, recipient common.Address, signature string) error {
+	return errors.New("evmtest: outgoing invoices are verified through their tx")
+}
+
+// GetBlockNumber implements evm.Verifier.
+func (v *verifier) GetBlockNumber(ctx context.Context) (uint64, error) {
+	return read(v.gateway, func() (uint64, error) {
+		return v.gateway.block, nil
+	})
+}
+
+// GetLatestHeader implements evm.Verifier. The head is always fresh.
+func (v *verifier) GetLatestHeader(ctx context.Context) (*types.Header, error) {
+	return read(v.gateway, func() (*types.Header, error) {
+		return &types.Header{
+			Number: new(big.Int).SetUint64(v.gateway.block),
+			Time:   uint64(time.Now().Unix()),
+		}, nil
+	})
+}
+
+// IsPaused implements evm.Verifier.
+func (v *verifier) IsPaused(ctx context.Context) (bool, error) {
+	return read(v.gateway, func() (bool, error) {
+		return v.gateway.paused, nil
+	})
+}
+
+// GetNextIdVerifyIncomingInvoice implements evm.Verifier.
+func (v *verifier) GetNextIdVerifyIncomingInvoice(ctx context.Context, operator common.Address) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		if v.gateway.validatorIndex(operator) == -1 {
+			return nil, fmt.Errorf("%w: %s", ErrNotValidator, operator.Hex())
+		}
+		return new(big.Int).SetUint64(v.gateway.nextIncoming[operator]), nil
+	})
+}
+
+// GetIncomingInvoiceCount implements evm.Verifier.
+func (v *verifier) GetIncomingInvoiceCount(ctx context.Context) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		return big.NewInt(int64(len(v.gateway.incoming))), nil
+	})
+}
+
+// GetIncomingInvoice implements evm.Verifier.
+func (v *verifier) GetIncomingInvoice(ctx context.Context, id uint64) (contracts.IGatewayIncomingInvoiceResponse, error) {
+	return read(v.gateway, func() (contracts.IGatewayIncomingInvoiceResponse, error) {
+		if id < 1 || id > uint64(len(v.gateway.incoming)) {
+			return contracts.IGatewayIncomingInvoiceResponse{}, fmt.Errorf("evmtest: incoming invoice %d not found", id)
+		}
+		return v.gateway.incoming[id-1].copy(), nil
+	})
+}
+
+// GetNextIdVerifyOutgoingInvoice implements evm.Verifier.
+func (v *verifier) GetNextIdVerifyOutgoingInvoice(ctx context.Context, operator common.Address) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		if v.gateway.validatorIndex(operator) == -1 {
+			return nil, fmt.Errorf("%w: %s", ErrNotValidator, operator.Hex())
+		}
+		return new(big.Int).SetUint64(v.gateway.nextOutgoing[operator]), nil
+	})
+}
+
+// GetOutgoingInvoiceCount implements evm.Verifier.
+func (v *verifier) GetOutgoingInvoiceCount(ctx context.Context) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		return big.NewInt(int64(len(v.gateway.outgoingInvoices))), nil
+	})
+}
+
+// GetOutgoingInvoice implements evm.Verifier.
+func (v *verifier) GetOutgoingInvoice(ctx context.Context, id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+	return read(v.gateway, func() (contracts.IGatewayOutgoingInvoiceResponse, error) {
+		if id < 1 || id > uint64(len(v.gateway.outgoingInvoices)) {
+			return contracts.IGatewayOutgoingInvoiceResponse{}, fmt.Errorf("evmtest: outgoing invoice %d not found", id)
+		}
+		return v.gateway.outgoingInvoices[id-1], nil
+	})
+}
+
+// GetOutgoingTxCount implements evm.Verifier.
+func (v *verifier) GetOutgoingTxCount(ctx context.Context) (*big.Int, error) {
+	return read(v.gateway, func() (*big.Int, error) {
+		return big.NewInt(int64(len(v.gateway.outgoingTxs))), nil
+	})
+}
+
+// GetOutgoingTx implements evm.Verifier.
+func (v *verifier) GetOutgoingTx(ctx context.Context, id *big.Int) (contracts.IGatewayOutgoingTxInfo, error) {
+	return read(v.gateway, func() (contracts.IGatewayOutgoingTxInfo, error) {
+		if id.Sign() < 1 || id.Uint64() > uint64(len(v.gateway.outgoingTxs)) {
+			return contracts.IGatewayOutgoingTxInfo{}, fmt.Errorf("evmtest: outgoing tx %s not found", id)
+		}
+		return v.gateway.outgoingTxs[id.Uint64()-1].copy(), nil
+	})
+}
+
+// VerifyOutgoingTx implements evm.Verifier.
+func (v *verifier) VerifyOutgoingTx(ctx context.Context, id uint64, isVerified bool, signature string) (common.Hash, error) {
+	return v.gateway.verifyOutgoingTx(v.address, id, isVerified, signature)
+}
+
+var _ evm.Verifier = &verifier{}
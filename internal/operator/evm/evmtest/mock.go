@@ -0,0 +1,225 @@
+package evmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrNotMocked is returned by mock methods without a function set.
+var ErrNotMocked = errors.New("evmtest: method not mocked")
+
+// MockVerifier implements evm.Verifier with a function per method, for tests
+// scripting each answer. Methods without a function return ErrNotMocked.
+type MockVerifier struct {
+	Address common.Address
+
+	GetBalanceFn                     func() (*big.Int, error)
+	GetGasPriceFn                    func() (*big.Int, error)
+	GetOperatorsFn                   func() ([]common.Address, error)
+	VerifyIncomingInvoiceFn          func(id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (common.Hash, error)
+	VerifyOutgoingInvoiceFn          func(id uint64, amount *big.Int, recipient common.Address, signature string) error
+	GetBlockNumberFn                 func() (uint64, error)
+	GetLatestHeaderFn                func() (*types.Header, error)
+	IsPausedFn                       func() (bool, error)
+	GetNextIdVerifyIncomingInvoiceFn func(operator common.Address) (*big.Int, error)
+	GetIncomingInvoiceCountFn        func() (*big.Int, error)
+	GetIncomingInvoiceFn             func(id uint64) (contracts.IGatewayIncomingInvoiceResponse, error)
+	GetNextIdVerifyOutgoingInvoiceFn func(operator common.Address) (*big.Int, error)
+	GetOutgoingInvoiceCountFn        func() (*big.Int, error)
+	GetOutgoingInvoiceFn             func(id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error)
+	GetOutgoingTxCountFn             func() (*big.Int, error)
+	GetOutgoingTxFn                  func(id *big.Int) (contracts.IGatewayOutgoingTxInfo, error)
+	VerifyOutgoingTxFn               func(id uint64, isVerified bool, signature string) (common.Hash, error)
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// Calls returns how many times method was called.
+func (m *MockVerifier) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+func (m *MockVerifier) called(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[method]++
+}
+
+func notMocked(method string) error {
+	return fmt.Errorf("%w: %s", ErrNotMocked, method)
+}
+
+// GetAddress implements evm.Verifier.
+func (m *MockVerifier) GetAddress() common.Address {
+	m.called("GetAddress")
+	return m.Address
+}
+
+// GetBalance implements evm.Verifier.
+func (m *MockVerifier) GetBalance(ctx context.Context) (*big.Int, error) {
+	m.called("GetBalance")
+	if m.GetBalanceFn == nil {
+		return nil, notMocked("GetBalance")
+	}
+	return m.GetBalanceFn()
+}
+
+// GetGasPrice implements evm.Verifier.
+func (m *MockVerifier) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	m.called("GetGasPrice")
+	if m.GetGasPriceFn == nil {
+		return nil, notMocked("GetGasPrice")
+	}
+	return m.GetGasPriceFn()
+}
+
+// GetOperators implements evm.Verifier.
+func (m *MockVerifier) GetOperators(ctx context.Context) ([]common.Address, error) {
+	m.called("GetOperators")
+	if m.GetOperatorsFn == nil {
+		return nil, notMocked("GetOperators")
+	}
+	return m.GetOperatorsFn()
+}
+
+// VerifyIncomingInvoice implements evm.Verifier.
+func (m *MockVerifier) VerifyIncomingInvoice(ctx context.Context, id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (common.Hash, error) {
+	m.called("VerifyIncomingInvoice")
+	if m.VerifyIncomingInvoiceFn == nil {
+		return common.Hash{}, notMocked("VerifyIncomingInvoice")
+	}
+	return m.VerifyIncomingInvoiceFn(id, utxo, amount, recipient, isVerified)
+}
+
+// VerifyOutgoingInvoice implements evm.Verifier.
+func (m *MockVerifier) VerifyOutgoingInvoice(ctx context.Context, id uint64, amount *big.Int, recipient common.Address, signature string) error {
+	m.called("VerifyOutgoingInvoice")
+	if m.VerifyOutgoingInvoiceFn == nil {
+		return notMocked("VerifyOutgoingInvoice")
+	}
+	return m.VerifyOutgoingInvoiceFn(id, amount, recipient, signature)
+}
+
+// GetBlockNumber implements evm.Verifier.
+func (m *MockVerifier) GetBlockNumber(ctx context.Context) (uint64, error) {
+	m.called("GetBlockNumber")
+	if m.GetBlockNumberFn == nil {
+		return 0, notMocked("GetBlockNumber")
+	}
+	return m.GetBlockNumberFn()
+}
+
+// GetLatestHeader implements evm.Verifier.
+func (m *MockVerifier) GetLatestHeader(ctx context.Context) (*types.Header, error) {
+	m.called("GetLatestHeader")
+	if m.GetLatestHeaderFn == nil {
+		return nil, notMocked("GetLatestHeader")
+	}
+	return m.GetLatestHeaderFn()
+}
+
+// IsPaused implements evm.Verifier.
+func (m *MockVerifier) IsPaused(ctx context.Context) (bool, error) {
+	m.called("IsPaused")
+	if m.IsPausedFn == nil {
+		return false, notMocked("IsPaused")
+	}
+	return m.IsPausedFn()
+}
+
+// GetNextIdVerifyIncomingInvoice implements evm.Verifier.
+func (m *MockVerifier) GetNextIdVerifyIncomingInvoice(ctx context.Context, operator common.Address) (*big.Int, error) {
+	m.called("GetNextIdVerifyIncomingInvoice")
+	if m.GetNextIdVerifyIncomingInvoiceFn == nil {
+		return nil, notMocked("GetNextIdVerifyIncomingInvoice")
+	}
+	return m.GetNextIdVerifyIncomingInvoiceFn(operator)
+}
+
+// GetIncomingInvoiceCount implements evm.Verifier.
+func (m *MockVerifier) GetIncomingInvoiceCount(ctx context.Context) (*big.Int, error) {
+	m.called("GetIncomingInvoiceCount")
+	if m.GetIncomingInvoiceCountFn == nil {
+		return nil, notMocked("GetIncomingInvoiceCount")
+	}
+	return m.GetIncomingInvoiceCountFn()
+}
+
+// GetIncomingInvoice implements evm.Verifier.
+func (m *MockVerifier) GetIncomingInvoice(ctx context.Context, id uint64) (contracts.IGatewayIncomingInvoiceResponse, error) {
+	m.called("GetIncomingInvoice")
+	if m.GetIncomingInvoiceFn == nil {
+		return contracts.IGatewayIncomingInvoiceResponse{}, notMocked("GetIncomingInvoice")
+	}
+	return m.GetIncomingInvoiceFn(id)
+}
+
+// GetNextIdVerifyOutgoingInvoice implements evm.Verifier.
+func (m *MockVerifier) GetNextIdVerifyOutgoingInvoice(ctx context.Context, operator common.Address) (*big.Int, error) {
+	m.called("GetNextIdVerifyOutgoingInvoice")
+	if m.GetNextIdVerifyOutgoingInvoiceFn == nil {
+		return nil, notMocked("GetNextIdVerifyOutgoingInvoice")
+	}
+	return m.GetNextIdVerifyOutgoingInvoiceFn(operator)
+}
+
+// GetOutgoingInvoiceCount implements evm.Verifier.
+func (m *MockVerifier) GetOutgoingInvoiceCount(ctx context.Context) (*big.Int, error) {
+	m.called("GetOutgoingInvoiceCount")
+	if m.GetOutgoingInvoiceCountFn == nil {
+		return nil, notMocked("GetOutgoingInvoiceCount")
+	}
+	return m.GetOutgoingInvoiceCountFn()
+}
+
+// GetOutgoingInvoice implements evm.Verifier.
+func (m *MockVerifier) GetOutgoingInvoice(ctx context.Context, id uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+	m.called("GetOutgoingInvoice")
+	if m.GetOutgoingInvoiceFn == nil {
+		return contracts.IGatewayOutgoingInvoiceResponse{}, notMocked("GetOutgoingInvoice")
+	}
+	return m.GetOutgoingInvoiceFn(id)
+}
+
+// GetOutgoingTxCount implements evm.Verifier.
+func (m *MockVerifier) GetOutgoingTxCount(ctx context.Context) (*big.Int, error) {
+	m.called("GetOutgoingTxCount")
+	if m.GetOutgoingTxCountFn == nil {
+		return nil, notMocked("GetOutgoingTxCount")
+	}
+	return m.GetOutgoingTxCountFn()
+}
+
+// GetOutgoingTx implements evm.Verifier.
+func (m *MockVerifier) GetOutgoingTx(ctx context.Context, id *big.Int) (contracts.IGatewayOutgoingTxInfo, error) {
+	m.called("GetOutgoingTx")
+	if m.GetOutgoingTxFn == nil {
+		return contracts.IGatewayOutgoingTxInfo{}, notMocked("GetOutgoingTx")
+	}
+	return m.GetOutgoingTxFn(id)
+}
+
+// VerifyOutgoingTx implements evm.Verifier.
+func (m *MockVerifier) VerifyOutgoingTx(ctx context.Context, id uint64, isVerified bool, signature string) (common.Hash, error) {
+	m.called("VerifyOutgoingTx")
+	if m.VerifyOutgoingTxFn == nil {
+		return common.Hash{}, notMocked("VerifyOutgoingTx")
+	}
+	return m.VerifyOutgoingTxFn(id, isVerified, signature)
+}
+
+var _ evm.Verifier = &MockVerifier{}
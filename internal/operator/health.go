@@ -0,0 +1,140 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultReadyLoopTicks = 3
+	defaultMaxEvmHeadAge  = 60
+)
+
+// HealthReport is the result of the liveness or readiness checks.
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of one liveness or readiness check.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func newHealthReport(checks ...HealthCheck) HealthReport {
+	report := HealthReport{Healthy: true, Checks: checks}
+	for _, check := range checks {
+		if !check.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+func healthy(name, detail string) HealthCheck {
+	return HealthCheck{Name: name, Healthy: true, Detail: detail}
+}
+
+func unhealthy(name string, err error) HealthCheck {
+	return HealthCheck{Name: name, Healthy: false, Detail: err.Error()}
+}
+
+// Liveness implements StatusProvider. The operator is alive while its event
+// loops keep ticking.
+func (op *Operator) Liveness() HealthReport {
+	return newHealthReport(op.loopChecks()...)
+}
+
+// Readiness implements StatusProvider. The operator is ready when both chains
+// are reachable and synced, keys are loaded and the event loops keep ticking.
+func (op *Operator) Readiness() HealthReport {
+	checks := []HealthCheck{
+		op.checkKeys(),
+		op.checkEvm(),
+		op.checkBitcoin(),
+		op.checkComponents(),
+	}
+	checks = append(checks, op.loopChecks()...)
+	return newHealthReport(checks...)
+}
+
+func (op *Operator) checkKeys() HealthCheck {
+	const name = "keys"
+	if op.evmVerifier.GetAddress() == (common.Address{}) {
+		return unhealthy(name, fmt.Errorf("evm key not loaded"))
+	}
+	if op.btcVerifier.GetPublicKey() == "" {
+		return unhealthy(name, fmt.Errorf("bitcoin key not loaded"))
+	}
+	return healthy(name, "")
+}
+
+func (op *Operator) checkEvm() HealthCheck {
+	const name = "evm"
+	header, err := op.evmVerifier.GetLatestHeader(op.ctx)
+	if err != nil {
+		return unhealthy(name, err)
+	}
+
+	maxAge := op.Config().Server.MaxEvmHeadAge
+	if maxAge <= 0 {
+		maxAge = defaultMaxEvmHeadAge
+	}
+	age := time.Since(time.Unix(int64(header.Time), 0))
+	if age > time.Duration(maxAge)*time.Second {
+		return unhealthy(name, fmt.Errorf("head %d is %s old", header.Number.Uint64(), age.Truncate(time.Second)))
+	}
+	return healthy(name, fmt.Sprintf("head %d", header.Number.Uint64()))
+}
+
+func (op *Operator) checkBitcoin() HealthCheck {
+	const name = "bitcoin"
+	info, err := op.btcVerifier.GetBlockChainInfo(op.ctx)
+	if err != nil {
+		return unhealthy(name, err)
+	}
+	if info.InitialBlockDownload {
+		return unhealthy(name, fmt.Errorf("initial block download in progress at %d/%d", info.Blocks, info.Headers))
+	}
+	return healthy(name, fmt.Sprintf("height %d", info.Blocks))
+}
+
+func (op *Operator) checkComponents() HealthCheck {
+	const name = "components"
+	for _, c := range op.supervisor.Components() {
+		if c.State != componentRunning {
+			return unhealthy(name, fmt.Errorf("%s is %s after %d restarts: %s", c.Name, c.State, c.Restarts, c.LastError))
+		}
+	}
+	return healthy(name, "")
+}
+
+// loopChecks reports a loop unhealthy when it has not ticked within the
+// configured number of query intervals.
+func (op *Operator) loopChecks() []HealthCheck {
+	ticks := op.Config().Server.ReadyLoopTicks
+	if ticks <= 0 {
+		ticks = defaultReadyLoopTicks
+	}
+	maxIdle := time.Duration(ticks) * op.queryInterval()
+
+	loops := op.status.loopTimes()
+	var checks []HealthCheck
+	for _, name := range []string{incomingLoopName, outgoingLoopName} {
+		checkName := fmt.Sprintf("%s_loop", name)
+		last, ok := loops[name]
+		if !ok {
+			last = op.startedAt
+		}
+		if idle := time.Since(last); idle > maxIdle {
+			checks = append(checks, unhealthy(checkName, fmt.Errorf("no tick for %s", idle.Truncate(time.Second))))
+			continue
+		}
+		checks = append(checks, healthy(checkName, ""))
+	}
+	return checks
+}
@@ -0,0 +1,54 @@
+package operator
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// inflightWork tracks operations that should not be interrupted halfway,
+// such as a vote waiting to be mined or a withdrawal being signed, so Stop
+// can wait for them and report the ones left behind.
+type inflightWork struct {
+	mu   sync.Mutex
+	next uint64
+	ops  map[uint64]string
+}
+
+func newInflightWork() *inflightWork {
+	return &inflightWork{ops: make(map[uint64]string)}
+}
+
+// begin marks desc as in flight until the returned func is called.
+func (w *inflightWork) begin(desc string) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.next
+	w.next++
+	w.ops[id] = desc
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.ops, id)
+	}
+}
+
+func (w *inflightWork) pending() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending := make([]string, 0, len(w.ops))
+	for _, desc := range w.ops {
+		pending = append(pending, desc)
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// inflightCtx returns a context for work marked by inflight.begin, keeping the
+// span of ctx. Stop cancels the operator context right away but lets such
+// work finish, cancelling it only when the drain deadline passes.
+func (op *Operator) inflightCtx(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(op.workCtx, trace.SpanFromContext(ctx))
+}
@@ -0,0 +1,94 @@
+package operator
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newStoppableOperator(t *testing.T) *Operator {
+	ctx, cancel := context.WithCancel(context.Background())
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	op := &Operator{
+		ctx:        ctx,
+		cancel:     cancel,
+		workCtx:    workCtx,
+		cancelWork: cancelWork,
+		logger:     slog.Default(),
+		status:     newStatusTracker(),
+		inflight:   newInflightWork(),
+		supervisor: newSupervisor(ctx, slog.Default()),
+	}
+	server, err := NewServer(ctx, op.logger, config.ServerInfo{HttpPort: "0"}, op)
+	require.NoError(t, err)
+	op.server = server
+	return op
+}
+
+func TestStopDrainsInflightWork(t *testing.T) {
+	op := newStoppableOperator(t)
+	finished := false
+	op.supervisor.Go("incoming", func(ctx context.Context) error {
+		<-ctx.Done()
+		done := op.inflight.begin("vote incoming invoice 1")
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+		done()
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, op.Stop(ctx))
+	require.True(t, finished)
+	require.Empty(t, op.inflight.pending())
+}
+
+func TestStopDrainTimeout(t *testing.T) {
+	op := newStoppableOperator(t)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	op.supervisor.Go("outgoing", func(ctx context.Context) error {
+		done := op.inflight.begin("sign and vote outgoing tx 7")
+		defer done()
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, op.Stop(ctx), ErrDrainTimeout)
+	require.Equal(t, []string{"sign and vote outgoing tx 7"}, op.inflight.pending())
+	close(release)
+}
+
+func TestStopCancelsInflightWork(t *testing.T) {
+	op := newStoppableOperator(t)
+	started := make(chan struct{})
+	var workErr error
+	op.supervisor.Go("incoming", func(ctx context.Context) error {
+		done := op.inflight.begin("vote incoming invoice 3")
+		defer done()
+		ctx = op.inflightCtx(ctx)
+		close(started)
+		// The vote outlives the operator context until the drain deadline
+		<-ctx.Done()
+		workErr = ctx.Err()
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.ErrorIs(t, op.Stop(ctx), ErrDrainTimeout)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	require.ErrorIs(t, workErr, context.Canceled)
+	require.Empty(t, op.inflight.pending())
+}
@@ -0,0 +1,104 @@
+package operator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Values of the component attribute of the logs, one logger per component.
+const (
+	componentEvm      = "evm"
+	componentBitcoin  = "bitcoin"
+	componentOperator = "operator"
+	componentServer   = "server"
+)
+
+// invoiceTrace follows one evaluation of an invoice, or outgoing tx, from
+// its discovery to the vote. Its logger tags every line with the invoice id,
+// direction and a correlation id unique to the evaluation. Once begun, its
+// ctx holds the span of the evaluation, the parent of the spans of the
+// contract reads, bitcoin lookups, signature and vote.
+type invoiceTrace struct {
+	ctx           context.Context
+	logger        *slog.Logger
+	correlationId string
+	direction     string
+	id            uint64
+	span          trace.Span
+}
+
+func (op *Operator) traceInvoice(direction string, id uint64) invoiceTrace {
+	correlationId := newCorrelationId()
+	return invoiceTrace{
+		ctx:           op.ctx,
+		logger:        op.invoiceLogger(direction, id, correlationId),
+		correlationId: correlationId,
+		direction:     direction,
+		id:            id,
+		span:          trace.SpanFromContext(op.ctx),
+	}
+}
+
+// begin starts the span of the evaluation, discovered at discovered, with a
+// discover span covering the time until now.
+func (t *invoiceTrace) begin(discovered time.Time) {
+	t.ctx, t.span = tracing.StartRoot(t.ctx, t.direction+" invoice", discovered,
+		attribute.Int64("invoice.id", int64(t.id)),
+		attribute.String("invoice.direction", t.direction),
+		attribute.String("correlation_id", t.correlationId),
+	)
+	tracing.Record(t.ctx, "discover", discovered)
+	if sc := t.span.SpanContext(); sc.IsValid() {
+		t.logger = t.logger.With("trace_id", sc.TraceID().String())
+	}
+}
+
+// fail ends the span of an evaluation cut short by err.
+func (t invoiceTrace) fail(err error) {
+	tracing.End(t.span, &err)
+}
+
+// end ends the span of the evaluation with the verdict of record.
+func (t invoiceTrace) end(record InvoiceRecord) {
+	t.span.SetAttributes(
+		attribute.String("verdict", record.Verdict),
+		attribute.String("reason", record.Reason),
+	)
+	if record.VoteTxHash != "" {
+		t.span.SetAttributes(attribute.String("vote_tx_hash", record.VoteTxHash))
+	}
+	if record.Error != "" {
+		t.span.SetStatus(codes.Error, record.Error)
+	}
+	t.span.End()
+}
+
+// voteCtx returns ctx for the vote on the evaluation, whose evm log lines
+// then carry the invoice id, direction and correlation id.
+func (t invoiceTrace) voteCtx(ctx context.Context) context.Context {
+	return evm.WithLogAttrs(ctx, invoiceLogAttrs(t.direction, t.id, t.correlationId)...)
+}
+
+// invoiceLogger returns the logger of the invoice evaluation correlationId.
+func (op *Operator) invoiceLogger(direction string, id uint64, correlationId string) *slog.Logger {
+	return op.logger.With(invoiceLogAttrs(direction, id, correlationId)...)
+}
+
+func invoiceLogAttrs(direction string, id uint64, correlationId string) []any {
+	return []any{"invoice_id", id, "direction", direction, "correlation_id", correlationId}
+}
+
+func newCorrelationId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,128 @@
+package operator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInvoiceLogCorrelation(t *testing.T) {
+	evmVerifier := &evmtest.MockVerifier{
+		Address: self,
+		VerifyIncomingInvoiceFn: func(uint64, string, *big.Int, common.Address, bool) (common.Hash, error) {
+			return common.Hash{7}, nil
+		},
+	}
+	gatewayWith(evmVerifier, 1, incomingInvoice(1, evm.Pending, false, false))
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(string, uint64, string) (bool, int64, error) { return true, 6, nil },
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	cfg := &config.Config{
+		Server: config.ServerInfo{HttpPort: "0"},
+		Evm:    config.EvmInfo{QueryInterval: 1},
+	}
+	op, err := NewOperatorWithVerifiers(context.Background(), cfg, logger, evmVerifier, btcVerifier)
+	require.NoError(t, err)
+	defer op.cancel()
+
+	require.NoError(t, op.processIncoming())
+	records := op.IncomingInvoices()
+	require.Len(t, records, 1)
+	correlationId := records[0].CorrelationId
+	require.NotEmpty(t, correlationId)
+
+	// Every line of the invoice carries its id, direction and correlation id,
+	// down to the vote
+	var invoiceLines []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		require.Equal(t, componentOperator, line["component"])
+		if line["correlation_id"] != nil {
+			invoiceLines = append(invoiceLines, line)
+		}
+	}
+	require.NotEmpty(t, invoiceLines)
+	for _, line := range invoiceLines {
+		require.Equal(t, correlationId, line["correlation_id"])
+		require.Equal(t, float64(1), line["invoice_id"])
+		require.Equal(t, directionIncoming, line["direction"])
+	}
+	last := invoiceLines[len(invoiceLines)-1]
+	require.Equal(t, "vote sent", last["msg"])
+	require.Equal(t, common.Hash{7}.Hex(), last["tx_hash"])
+}
+
+func TestInvoiceSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	tx := contracts.IGatewayOutgoingTxInfo{
+		TxId:       big.NewInt(1),
+		InvoiceIds: []*big.Int{big.NewInt(1)},
+		TxContent:  withdrawalTx(t, 500),
+		Status:     uint8(evm.Pending),
+	}
+	evmVerifier := &evmtest.MockVerifier{
+		GetOutgoingTxCountFn:             func() (*big.Int, error) { return big.NewInt(1), nil },
+		GetOutgoingTxFn:                  func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil },
+		GetNextIdVerifyOutgoingInvoiceFn: func(common.Address) (*big.Int, error) { return big.NewInt(1), nil },
+		GetOutgoingInvoiceFn: func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+			return contracts.IGatewayOutgoingInvoiceResponse{
+				InvoiceId: big.NewInt(1),
+				Amount:    big.NewInt(500),
+				Recipient: withdrawalAddr,
+				Status:    uint8(evm.Pending),
+			}, nil
+		},
+		VerifyOutgoingTxFn: func(uint64, bool, string) (common.Hash, error) { return common.Hash{1}, nil },
+	}
+	btcVerifier := &bitcointest.MockVerifier{
+		ConvertToAddressFn: regtestAddress,
+		SignFn:             func(*wire.MsgTx) ([]byte, error) { return []byte{0xab}, nil },
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	op.processOutgoing()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 3)
+	root := spans["outgoing invoice"]
+	require.NotNil(t, root)
+	for _, name := range []string{"discover", "check outputs"} {
+		require.Equal(t, root.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	require.Equal(t, int64(1), attrs["invoice.id"].AsInt64())
+	require.Equal(t, verdictValid, attrs["verdict"].AsString())
+	require.Equal(t, common.Hash{1}.Hex(), attrs["vote_tx_hash"].AsString())
+	require.Equal(t, op.OutgoingInvoices()[0].CorrelationId, attrs["correlation_id"].AsString())
+}
@@ -4,114 +4,212 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/aura-nw/lotus-core/clients/evm/contracts"
 	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/audit"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
 	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
 	"github.com/aura-nw/lotus-operator/internal/operator/evm"
 	"github.com/aura-nw/lotus-operator/internal/operator/types"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ErrDrainTimeout is returned by Stop when in-flight work outlives its deadline.
+var ErrDrainTimeout = errors.New("operator did not drain in time")
+
+// cancelGrace is how long Stop waits for in-flight work to return once it
+// cancelled it.
+const cancelGrace = time.Second
+
+// errOutputsMismatch is returned when a bitcoin tx does not pay the outputs of
+// its outgoing invoices.
+var errOutputsMismatch = errors.New("tx outputs do not match invoices")
+
 type Operator struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	// workCtx is the context of in-flight work, see inflightCtx. Stop cancels
+	// it after ctx, once the work drained or the drain deadline passed.
+	workCtx    context.Context
+	cancelWork context.CancelFunc
 
-	logger *slog.Logger
-	config *config.Config
+	logger   *slog.Logger
+	config   atomic.Pointer[config.Config]
+	reloader *configReloader
 
 	evmVerifier evm.Verifier
 	btcVerifier bitcoin.Verifier
-
-	server *Server
+	balance     *evm.BalanceMonitor
+
+	server     *Server
+	supervisor *supervisor
+	status     *statusTracker
+	inflight   *inflightWork
+	// shadow is nil unless the operator runs in shadow mode
+	shadow *shadowState
+	// audit is nil unless an audit log is configured
+	audit     *audit.Log
+	startedAt time.Time
 }
 
 func NewOperator(ctx context.Context, config *config.Config, logger *slog.Logger) (*Operator, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	op := &Operator{
-		ctx:    ctx,
-		cancel: cancel,
-		config: config,
-		logger: logger,
-	}
+	return NewOperatorWithTransport(ctx, config, logger, nil)
+}
 
-	if err := op.initVerifier(); err != nil {
+// NewOperatorWithTransport returns an operator whose verifiers send their
+// http requests to both chains with transport, such as an rpctrace recorder
+// or replayer. A nil transport dials the chains directly.
+func NewOperatorWithTransport(ctx context.Context, config *config.Config, logger *slog.Logger, transport http.RoundTripper) (*Operator, error) {
+	// Init evm verifier
+	evmVerifier, err := evm.NewVerifierWithTransport(logger.With("component", componentEvm), config.Evm, transport)
+	if err != nil {
+		logger.Error("init evm verifier failed", "err", err)
 		return nil, err
 	}
 
-	server, err := NewServer(ctx, op.logger, op.config.Server)
+	// Init bitcoin verifier
+	btcVerifier, err := bitcoin.NewVerifierWithTransport(logger.With("component", componentBitcoin), config.Bitcoin, transport)
 	if err != nil {
+		logger.Error("init bitcoin verifier failed", "err", err)
 		return nil, err
 	}
-	op.server = server
 
-	return op, nil
+	return NewOperatorWithVerifiers(ctx, config, logger, evmVerifier, btcVerifier)
 }
 
-func (op *Operator) initVerifier() error {
-	// Init evm verifier
-	evmVerifier, err := evm.NewVerifier(op.logger, op.config.Evm)
+// NewOperatorWithVerifiers returns an operator voting through evmVerifier and
+// checking bitcoin through btcVerifier, such as the fakes of evmtest and
+// bitcointest.
+func NewOperatorWithVerifiers(ctx context.Context, config *config.Config, logger *slog.Logger, evmVerifier evm.Verifier, btcVerifier bitcoin.Verifier) (*Operator, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	opLogger := logger.With("component", componentOperator)
+	op := &Operator{
+		ctx:         ctx,
+		cancel:      cancel,
+		workCtx:     workCtx,
+		cancelWork:  cancelWork,
+		logger:      opLogger,
+		evmVerifier: evmVerifier,
+		btcVerifier: btcVerifier,
+		status:      newStatusTracker(),
+		inflight:    newInflightWork(),
+		supervisor:  newSupervisor(ctx, logger),
+	}
+	op.config.Store(config)
+	if config.Shadow() {
+		op.shadow = newShadowState()
+	}
+
+	balance, err := evm.NewBalanceMonitor(logger.With("component", componentEvm), config.Evm, evmVerifier)
 	if err != nil {
-		op.logger.Error("init evm verifier failed", "err", err)
-		return err
+		op.logger.Error("init evm balance monitor failed", "err", err)
+		cancel()
+		cancelWork()
+		return nil, err
 	}
-	op.evmVerifier = evmVerifier
+	op.balance = balance
 
-	// Init bitcoin verifier
-	btcVerifier, err := bitcoin.NewVerifier(op.logger, op.config.Bitcoin)
+	server, err := NewServer(ctx, logger.With("component", componentServer), config.Server, op)
 	if err != nil {
-		op.logger.Error("init bitcoin verifier failed", "err", err)
-		return err
+		cancel()
+		cancelWork()
+		return nil, err
 	}
-	op.btcVerifier = btcVerifier
+	op.server = server
 
-	return nil
+	if config.Audit.Path != "" {
+		if err := op.openAudit(config.Audit.Path, config.Audit.Sign, config.Evm.PrivateKey); err != nil {
+			op.logger.Error("open audit log failed", "err", err)
+			cancel()
+			cancelWork()
+			return nil, err
+		}
+	}
+
+	return op, nil
+}
+
+// Config returns the config currently in use, which changes on reload.
+func (op *Operator) Config() *config.Config {
+	return op.config.Load()
+}
+
+// queryInterval returns the current event loop interval.
+func (op *Operator) queryInterval() time.Duration {
+	return time.Duration(op.Config().Evm.QueryInterval) * time.Second
 }
 
 func (op *Operator) Start() {
-	op.logger.Info("starting operator service", "evm_address", op.evmVerifier.GetAddress().Hex())
-	go op.incomingEventsLoop()
-	go op.outgoingEventsLoop()
+	op.startedAt = time.Now()
+	op.logger.Info("starting operator service", "evm_address", op.evmVerifier.GetAddress().Hex(), "shadow", op.shadow != nil)
+	op.supervisor.Go("balance", func(ctx context.Context) error {
+		op.balance.Run(ctx)
+		return nil
+	})
+	op.supervisor.Go(incomingLoopName, op.incomingEventsLoop)
+	op.supervisor.Go(outgoingLoopName, op.outgoingEventsLoop)
+
+	if op.reloader != nil {
+		op.supervisor.Go("config", op.reloader.watch)
+	}
 
-	op.logger.Info("starting operator server", "port", op.config.Server.HttpPort)
-	go op.server.Start()
+	op.logger.Info("starting operator server", "port", op.Config().Server.HttpPort)
+	op.supervisor.Go("server", func(ctx context.Context) error {
+		return op.server.Start()
+	})
 }
 
 func (op *Operator) findNextIncomingIdNeedVerify() (uint64, error) {
 	address := op.evmVerifier.GetAddress()
-	nextId, err := op.evmVerifier.GetNextIdVerifyIncomingInvoice(address)
+	nextId, err := op.evmVerifier.GetNextIdVerifyIncomingInvoice(op.ctx, address)
 	if err != nil {
 		op.logger.Error("get next id verify incomint invoice error", "err", err)
 		return 0, err
 	}
 	id := nextId.Uint64()
 	for {
-		count, err := op.evmVerifier.GetIncomingInvoiceCount()
+		count, err := op.evmVerifier.GetIncomingInvoiceCount(op.ctx)
 		if err != nil {
 			op.logger.Error("get incoming invoice count error", "err", err)
 			return 0, err
 		}
+		metrics.SetLoopLag(directionIncoming, count.Uint64(), id)
 		if id > count.Uint64() {
 			op.logger.Info("no incoming invoice need verify")
 			return 0, fmt.Errorf("no incoming invoice need verify")
 		}
-		invoice, err := op.evmVerifier.GetIncomingInvoice(id)
+		invoice, err := op.evmVerifier.GetIncomingInvoice(op.ctx, id)
 		if err != nil {
-			op.logger.Error("get incoming invoice error", "err", err, "id", id, "err", err)
+			op.logger.Error("get incoming invoice error", "invoice_id", id, "direction", directionIncoming, "err", err)
 			return 0, err
 		}
 		if evm.InvoiceStatus(invoice.Status) != evm.Pending {
-			op.logger.Info("incoming invoice no need verify", "id", id, "status", invoice.Status)
+			op.logger.Info("incoming invoice no need verify", "invoice_id", id, "direction", directionIncoming, "status", invoice.Status)
+			op.status.clearVote(directionIncoming, id)
 			id++
 			continue
 		}
 
 		if op.isVerified(invoice) {
-			op.logger.Info("invoice has self-verified", "address", address.Hex())
+			op.logger.Info("invoice has self-verified", "invoice_id", id, "direction", directionIncoming, "address", address.Hex())
+			op.status.clearVote(directionIncoming, id)
+			id++
+			continue
+		}
+		if op.status.voted(directionIncoming, id) {
+			op.logger.Info("invoice vote sent, waiting for confirmations", "invoice_id", id, "direction", directionIncoming)
 			id++
 			continue
 		}
@@ -120,154 +218,416 @@ func (op *Operator) findNextIncomingIdNeedVerify() (uint64, error) {
 
 }
 
-func (op *Operator) incomingEventsLoop() {
+func (op *Operator) incomingEventsLoop(ctx context.Context) error {
 	op.logger.Info("starting incoming events loop")
 
-	ticker := time.NewTicker(time.Duration(op.config.Evm.QueryInterval) * time.Second)
+	interval := op.queryInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-op.ctx.Done():
+		case <-ctx.Done():
 			op.logger.Info("context done")
-			return
+			return nil
 		case <-ticker.C:
-			nextId, err := op.findNextIncomingIdNeedVerify()
-			if err != nil {
-				op.logger.Error("find next incoming invoice id error", "err", err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			op.logger.Info("next incoming id for verify", "id", nextId)
-
-			// Process next id
-			invoice, err := op.evmVerifier.GetIncomingInvoice(nextId)
-			if err != nil {
-				op.logger.Error("get incoming invoice error", "err", err, "id", nextId, "err", err)
-				continue
-			}
-			op.logger.Info("found incoming invoice", "id", nextId)
-
-			// Verify invoice
-			valid, err := op.btcVerifier.VerifyBtcDeposit(invoice.Utxo, invoice.Amount.Uint64(), invoice.Recipient.Hex())
-			if err != nil {
-				op.logger.Error("verify btc deposit failed", "err", err)
-				continue
+			op.status.markLoop(incomingLoopName)
+			if next := op.queryInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
 			}
-			if !valid {
-				op.logger.Info("btc deposit not vaild", "id", invoice.InvoiceId)
-				// Vote no and wait
-				if err := op.evmVerifier.VerifyIncomingInvoice(
-					invoice.InvoiceId.Uint64(),
-					invoice.Utxo,
-					invoice.Amount,
-					invoice.Recipient,
-					false,
-				); err != nil {
-					op.logger.Error("verify incomming invoice error", "err", err)
-					continue
-				}
+			if op.shadow != nil {
+				op.processShadow(directionIncoming)
 				continue
 			}
-			// Vote yes and wait
-			op.logger.Info("btc deposit vaild", "id", invoice.InvoiceId)
-			if err := op.evmVerifier.VerifyIncomingInvoice(
-				invoice.InvoiceId.Uint64(),
-				invoice.Utxo, invoice.Amount,
-				invoice.Recipient, true,
-			); err != nil {
-				op.logger.Error("verify incomming invoice error", "err", err)
-				continue
+			if err := op.processIncoming(); err != nil {
+				time.Sleep(1 * time.Second)
 			}
 		}
 	}
 }
 
-func (op *Operator) outgoingEventsLoop() {
+// processIncoming verifies and votes on the next incoming invoice we have not
+// verified. It returns an error when no invoice could be picked.
+func (op *Operator) processIncoming() error {
+	discovered := time.Now()
+	nextId, err := op.findNextIncomingIdNeedVerify()
+	if err != nil {
+		op.logger.Error("find next incoming invoice id error", "err", err)
+		return err
+	}
+	trace := op.traceInvoice(directionIncoming, nextId)
+	trace.begin(discovered)
+	trace.logger.Info("next incoming id for verify")
+
+	// Process next id
+	invoice, err := op.evmVerifier.GetIncomingInvoice(trace.ctx, nextId)
+	if err != nil {
+		trace.logger.Error("get incoming invoice error", "err", err)
+		trace.fail(err)
+		return nil
+	}
+	trace.logger.Info("found incoming invoice")
+	metrics.InvoicesSeen.WithLabelValues(directionIncoming).Inc()
+	record, valid := op.verifyIncoming(trace, nextId, invoice)
+	defer func() { trace.end(record) }()
+	if record.Verdict == verdictError {
+		op.recordVerdict(record)
+		return nil
+	}
+
+	// Vote and wait
+	if !op.canAffordVote(&record) {
+		op.recordVerdict(record)
+		return nil
+	}
+	done := op.inflight.begin(fmt.Sprintf("vote incoming invoice %d", nextId))
+	trace.ctx = op.inflightCtx(trace.ctx)
+	txHash, err := op.evmVerifier.VerifyIncomingInvoice(
+		trace.voteCtx(trace.ctx),
+		invoice.InvoiceId.Uint64(),
+		invoice.Utxo,
+		invoice.Amount,
+		invoice.Recipient,
+		valid,
+	)
+	done()
+	if err != nil {
+		trace.logger.Error("verify incomming invoice error", "err", err)
+	}
+	op.recordVote(trace, &record, txHash, err)
+	op.recordVerdict(record)
+	return nil
+}
+
+// verifyIncoming checks the deposit of the incoming invoice id, without
+// voting, and returns the verdict record and the vote it calls for.
+func (op *Operator) verifyIncoming(trace invoiceTrace, id uint64, invoice contracts.IGatewayIncomingInvoiceResponse) (InvoiceRecord, bool) {
+	record := InvoiceRecord{
+		Id:            id,
+		Direction:     directionIncoming,
+		CorrelationId: trace.correlationId,
+		Utxo:          invoice.Utxo,
+		Amount:        invoice.Amount.String(),
+		Recipient:     invoice.Recipient.Hex(),
+	}
+
+	// Verify invoice
+	valid, confirmations, err := op.btcVerifier.VerifyBtcDeposit(trace.ctx, invoice.Utxo, invoice.Amount.Uint64(), invoice.Recipient.Hex())
+	record.DepositConfirmations = confirmations
+	if err != nil {
+		trace.logger.Error("verify btc deposit failed", "err", err)
+		record.Verdict = verdictError
+		record.Reason = reasonDepositLookup
+		record.Error = err.Error()
+		return record, false
+	}
+	record.Verdict, record.Reason = verdictValid, reasonDepositVerified
+	if !valid {
+		trace.logger.Info("btc deposit not vaild")
+		record.Verdict, record.Reason = verdictInvalid, reasonDepositInvalid
+	} else {
+		trace.logger.Info("btc deposit vaild")
+	}
+	return record, valid
+}
+
+func (op *Operator) outgoingEventsLoop(ctx context.Context) error {
 	op.logger.Info("starting outgoing events loop")
-	ticker := time.NewTicker(time.Duration(op.config.Evm.QueryInterval) * time.Second)
+	interval := op.queryInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-op.ctx.Done():
+		case <-ctx.Done():
 			op.logger.Info("context done")
-			return
+			return nil
 		case <-ticker.C:
-			lastId, err := op.evmVerifier.GetOutgoingTxCount()
-			if err != nil {
-				op.logger.Error("get last id failed", "err", err)
-				continue
+			op.status.markLoop(outgoingLoopName)
+			if next := op.queryInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
 			}
-			if lastId == nil || lastId.Cmp(big.NewInt(0)) == 0 {
-				op.logger.Info("no outgoing tx")
+			if op.shadow != nil {
+				op.processShadow(directionOutgoing)
 				continue
 			}
-			op.logger.Info("outgoingEventsLoop", "last_id", lastId.Uint64())
+			op.updateOutgoingLag()
+			op.processOutgoing()
+		}
+	}
+}
 
-			// Process next id
-			txOutgoing, err := op.evmVerifier.GetOutgoingTx(lastId)
-			if err != nil {
-				op.logger.Error("get outgoing invoice error", "err", err, "id", lastId.Uint64())
-				continue
-			}
+// processOutgoing verifies, signs and votes on the latest outgoing tx while
+// it is pending.
+func (op *Operator) processOutgoing() {
+	discovered := time.Now()
+	lastId, err := op.evmVerifier.GetOutgoingTxCount(op.ctx)
+	if err != nil {
+		op.logger.Error("get last id failed", "err", err)
+		return
+	}
+	if lastId == nil || lastId.Cmp(big.NewInt(0)) == 0 {
+		op.logger.Info("no outgoing tx")
+		return
+	}
+	trace := op.traceInvoice(directionOutgoing, lastId.Uint64())
+	trace.logger.Info("outgoingEventsLoop", "last_id", lastId.Uint64())
 
-			op.logger.Info("found invoice", "id", lastId)
+	// Process next id
+	txOutgoing, err := op.evmVerifier.GetOutgoingTx(op.ctx, lastId)
+	if err != nil {
+		trace.logger.Error("get outgoing invoice error", "err", err)
+		return
+	}
 
-			if evm.InvoiceStatus(txOutgoing.Status) != evm.Pending {
-				op.logger.Info("outgoing invoice no need verify", "id", lastId, "status", txOutgoing.Status)
-				continue
-			}
+	trace.logger.Info("found invoice")
 
-			isValidate := true
-			outputs := make([]types.Utxo, 0)
-			for _, invoiceId := range txOutgoing.InvoiceIds {
-				invoice, err := op.evmVerifier.GetOutgoingInvoice(invoiceId.Uint64())
-				if err != nil {
-					op.logger.Error("get outgoing invoice error", "err", err, "id", invoiceId)
-					isValidate = false
-					continue
-				}
-
-				if evm.InvoiceStatus(invoice.Status) != evm.Pending {
-					op.logger.Info("outgoing invoice no need verify", "id", invoiceId, "status", invoice.Status)
-					continue
-				}
-
-				outputs = append(outputs, types.Utxo{
-					Address: invoice.Recipient,
-					Amount:  invoice.Amount.Int64(),
-				})
-			}
-			if !isValidate {
-				op.logger.Info("outgoing invoice not validate", "id", lastId)
-				// submit verify failed to contract
-				if err := op.evmVerifier.VerifyOutgoingTx(lastId.Uint64(), false, ""); err != nil {
-					op.logger.Error("verify outgoing tx error", "err", err)
-					continue
-				}
-			}
+	if evm.InvoiceStatus(txOutgoing.Status) != evm.Pending {
+		trace.logger.Info("outgoing invoice no need verify", "status", txOutgoing.Status)
+		op.status.clearVote(directionOutgoing, lastId.Uint64())
+		return
+	}
+	voted, err := op.hasVoted(trace.ctx, txOutgoing)
+	if err != nil {
+		trace.logger.Error("get next id verify outgoing invoice error", "err", err)
+		return
+	}
+	if voted {
+		trace.logger.Info("outgoing tx has self-verified")
+		op.status.clearVote(directionOutgoing, lastId.Uint64())
+		return
+	}
+	if op.status.voted(directionOutgoing, lastId.Uint64()) {
+		trace.logger.Info("outgoing tx has self-verified, waiting for confirmations")
+		return
+	}
 
-			// Verify and sign btc
-			signature, err := op.verifyAndSignBtc(txOutgoing.TxContent, outputs)
-			if err != nil {
-				op.logger.Error("verify and sign btc error", "err", err)
-				continue
-			}
+	trace.begin(discovered)
+	metrics.InvoicesSeen.WithLabelValues(directionOutgoing).Inc()
+	done := op.inflight.begin(fmt.Sprintf("sign and vote outgoing tx %d", lastId))
+	defer done()
+	trace.ctx = op.inflightCtx(trace.ctx)
+	record, signature := op.verifyOutgoing(trace, lastId.Uint64(), txOutgoing, false)
+	defer func() { trace.end(record) }()
+	if record.Verdict == verdictError {
+		op.recordVerdict(record)
+		return
+	}
 
-			// submit verify success to contract
-			if err := op.evmVerifier.VerifyOutgoingTx(lastId.Uint64(), true, hex.EncodeToString(signature)); err != nil {
-				op.logger.Error("verify outgoing tx error", "err", err)
-				continue
-			}
+	// submit the verdict to contract
+	if !op.canAffordVote(&record) {
+		op.recordVerdict(record)
+		return
+	}
+	valid := record.Verdict == verdictValid
+	txHash, err := op.evmVerifier.VerifyOutgoingTx(trace.voteCtx(trace.ctx), lastId.Uint64(), valid, hex.EncodeToString(signature))
+	if err != nil {
+		trace.logger.Error("verify outgoing tx error", "err", err)
+	}
+	op.recordVote(trace, &record, txHash, err)
+	op.recordVerdict(record)
+}
+
+// verifyOutgoing checks the outgoing tx id pays its invoices and signs it,
+// without voting. It returns the verdict record and the signature to vote
+// with, nil unless the verdict is valid. Invoices no longer pending are left
+// out of the outputs unless settled is set, as when replaying a paid tx.
+func (op *Operator) verifyOutgoing(trace invoiceTrace, id uint64, txOutgoing contracts.IGatewayOutgoingTxInfo, settled bool) (InvoiceRecord, []byte) {
+	record := InvoiceRecord{
+		Id:            id,
+		Direction:     directionOutgoing,
+		CorrelationId: trace.correlationId,
+	}
+	isValidate := true
+	outputs := make([]types.Utxo, 0)
+	for _, invoiceId := range txOutgoing.InvoiceIds {
+		record.InvoiceIds = append(record.InvoiceIds, invoiceId.Uint64())
+		invoice, err := op.evmVerifier.GetOutgoingInvoice(trace.ctx, invoiceId.Uint64())
+		if err != nil {
+			trace.logger.Error("get outgoing invoice error", "outgoing_invoice_id", invoiceId, "err", err)
+			isValidate = false
+			continue
+		}
+
+		if !settled && evm.InvoiceStatus(invoice.Status) != evm.Pending {
+			trace.logger.Info("outgoing invoice no need verify", "outgoing_invoice_id", invoiceId, "status", invoice.Status)
+			continue
 		}
+
+		outputs = append(outputs, types.Utxo{
+			Address: invoice.Recipient,
+			Amount:  invoice.Amount.Int64(),
+		})
+	}
+	if !isValidate {
+		trace.logger.Info("outgoing invoice not validate")
+		record.Verdict, record.Reason = verdictInvalid, reasonInvoiceLookup
+		return record, nil
+	}
+
+	// Verify and sign btc
+	signature, err := op.verifyAndSignBtc(trace, txOutgoing.TxContent, outputs)
+	if errors.Is(err, errOutputsMismatch) {
+		trace.logger.Info("outgoing tx does not pay its invoices", "err", err)
+		record.Verdict, record.Reason = verdictInvalid, reasonOutputsMismatch
+		record.Error = err.Error()
+		return record, nil
+	}
+	if err != nil {
+		trace.logger.Error("verify and sign btc error", "err", err)
+		record.Verdict, record.Reason = verdictError, reasonVerifyAndSignBtc
+		record.Error = err.Error()
+		return record, nil
+	}
+	record.Verdict, record.Reason = verdictValid, reasonOutputsVerified
+	return record, signature
+}
+
+// recordVote attaches the outcome of a vote transaction to record.
+func (op *Operator) recordVote(trace invoiceTrace, record *InvoiceRecord, txHash common.Hash, err error) {
+	metrics.ObserveVote(record.Direction, err)
+	if txHash != (common.Hash{}) {
+		record.VoteTxHash = txHash.Hex()
+		trace.logger.Info("vote sent", "verdict", record.Verdict, "tx_hash", record.VoteTxHash)
+	}
+	if err != nil {
+		record.Error = fmt.Sprintf("vote failed: %s", err)
+	}
+	// A vote whose wait failed may still be mined, so any hash counts
+	if txHash != (common.Hash{}) {
+		op.status.markVoted(record.Direction, record.Id)
+	}
+}
+
+// recordVerdict stores record for the status API. It counts and audits the
+// verdict once per id unless it changes on a retry, and audits every vote.
+func (op *Operator) recordVerdict(record InvoiceRecord) {
+	changed := op.status.record(record)
+	if changed {
+		metrics.Verdicts.WithLabelValues(record.Direction, record.Verdict, record.Reason).Inc()
+	}
+	if changed || record.VoteTxHash != "" {
+		op.auditVerdict(record)
+	}
+}
+
+// canAffordVote reports whether the operator balance covers a vote, and
+// records the skipped vote on record when it does not.
+func (op *Operator) canAffordVote(record *InvoiceRecord) bool {
+	if err := op.balance.CanAffordVote(); err != nil {
+		op.invoiceLogger(record.Direction, record.Id, record.CorrelationId).Warn("skip sending vote", "err", err)
+		metrics.VotesSkipped.WithLabelValues(record.Direction).Inc()
+		record.Error = fmt.Sprintf("vote skipped: %s", err)
+		return false
+	}
+	return true
+}
+
+func (op *Operator) updateOutgoingLag() {
+	nextId, err := op.evmVerifier.GetNextIdVerifyOutgoingInvoice(op.ctx, op.evmVerifier.GetAddress())
+	if err != nil {
+		op.logger.Error("get next id verify outgoing invoice error", "err", err)
+		return
+	}
+	count, err := op.evmVerifier.GetOutgoingInvoiceCount(op.ctx)
+	if err != nil {
+		op.logger.Error("get outgoing invoice count error", "err", err)
+		return
 	}
+	metrics.SetLoopLag(directionOutgoing, count.Uint64(), nextId.Uint64())
 }
 
-func (op *Operator) Stop() {
+// Stop cancels the operator context, which aborts the chain reads of the
+// loops, and waits until in-flight votes and signatures finish or ctx is
+// done. Work still in flight at the deadline is cancelled. It is not lost:
+// the loops resume from the on-chain cursor on the next start.
+func (op *Operator) Stop(ctx context.Context) error {
 	op.logger.Info("stopping operator service")
 	op.cancel()
-	op.server.Stop()
+	defer op.cancelWork()
+	op.server.Stop(ctx)
+
+	drained := make(chan struct{})
+	go func() {
+		op.supervisor.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		op.logger.Info("operator service stopped")
+		op.closeAudit()
+		return nil
+	case <-ctx.Done():
+		pending := op.inflight.pending()
+		op.logger.Error("operator service did not drain in time, cancelling pending work, it resumes on restart", "pending", pending)
+		op.cancelWork()
+		select {
+		case <-drained:
+			op.closeAudit()
+		case <-time.After(cancelGrace):
+			op.logger.Error("pending work did not return after cancellation", "pending", op.inflight.pending())
+		}
+		return fmt.Errorf("%w: %d operations in flight", ErrDrainTimeout, len(pending))
+	}
+}
+
+// Status implements StatusProvider.
+func (op *Operator) Status() Status {
+	status := Status{
+		Mode:            config.ModeVote,
+		EvmAddress:      op.evmVerifier.GetAddress().Hex(),
+		BtcPubKey:       op.btcVerifier.GetPublicKey(),
+		MultisigAddress: op.btcVerifier.GetMultisigAddr(),
+		Balance:         op.balance.Info(),
+		Loops:           op.status.loopTimes(),
+		Components:      op.supervisor.Components(),
+		Config:          op.configStatus(),
+		Errors:          make(map[string]string),
+	}
+	if op.shadow != nil {
+		status.Mode = config.ModeShadow
+	}
+	if v, ok := op.evmVerifier.(interface{ Endpoints() []evm.EndpointHealth }); ok {
+		status.EvmEndpoints = v.Endpoints()
+	}
+
+	evmHeight, err := op.evmVerifier.GetBlockNumber(op.ctx)
+	if err != nil {
+		status.Errors["evm_height"] = err.Error()
+	}
+	status.EvmHeight = evmHeight
+
+	btcHeight, err := op.btcVerifier.GetBlockCount(op.ctx)
+	if err != nil {
+		status.Errors["btc_height"] = err.Error()
+	}
+	status.BtcHeight = btcHeight
+
+	paused, err := op.evmVerifier.IsPaused(op.ctx)
+	if err != nil {
+		status.Errors["paused"] = err.Error()
+	}
+	status.Paused = paused
+
+	return status
+}
+
+// IncomingInvoices implements StatusProvider.
+func (op *Operator) IncomingInvoices() []InvoiceRecord {
+	return op.status.recent(directionIncoming)
+}
+
+// OutgoingInvoices implements StatusProvider.
+func (op *Operator) OutgoingInvoices() []InvoiceRecord {
+	return op.status.recent(directionOutgoing)
+}
+
+// Operators implements StatusProvider.
+func (op *Operator) Operators() ([]common.Address, error) {
+	return op.evmVerifier.GetOperators(op.ctx)
 }
 
 func (op *Operator) isVerified(invoice contracts.IGatewayIncomingInvoiceResponse) bool {
@@ -278,6 +638,30 @@ func (op *Operator) isVerified(invoice contracts.IGatewayIncomingInvoiceResponse
 	return invoice.Confirmations[myIndex]
 }
 
+// hasVoted reports whether the gateway shows our vote on the outgoing tx. A
+// signature shows in our slot, a rejection leaves it empty and shows only as
+// our outgoing cursor past every invoice of the tx.
+func (op *Operator) hasVoted(ctx context.Context, tx contracts.IGatewayOutgoingTxInfo) (bool, error) {
+	for index, address := range tx.Validators {
+		if address == op.evmVerifier.GetAddress() && index < len(tx.Signatures) && tx.Signatures[index] != "" {
+			return true, nil
+		}
+	}
+	if len(tx.InvoiceIds) == 0 {
+		return false, nil
+	}
+	nextId, err := op.evmVerifier.GetNextIdVerifyOutgoingInvoice(ctx, op.evmVerifier.GetAddress())
+	if err != nil {
+		return false, err
+	}
+	for _, invoiceId := range tx.InvoiceIds {
+		if nextId.Cmp(invoiceId) <= 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func (op *Operator) indexOnIncommingInvoice(invoice contracts.IGatewayIncomingInvoiceResponse) int {
 	for index, address := range invoice.Validators {
 		if op.evmVerifier.GetAddress() == address {
@@ -287,27 +671,49 @@ func (op *Operator) indexOnIncommingInvoice(invoice contracts.IGatewayIncomingIn
 	return -1
 }
 
-func (op *Operator) verifyAndSignBtc(txContext string, outputs []types.Utxo) ([]byte, error) {
+func (op *Operator) verifyAndSignBtc(trace invoiceTrace, txContext string, outputs []types.Utxo) ([]byte, error) {
 	txBytes, err := hex.DecodeString(txContext)
 	if err != nil {
-		op.logger.Error("decode tx context error", "err", err)
+		trace.logger.Error("decode tx context error", "err", err)
 		return nil, err
 	}
 
 	var msgTx wire.MsgTx
 	if err := msgTx.Deserialize(bytes.NewReader(txBytes)); err != nil {
-		op.logger.Error("deserialize tx error", "err", err)
+		trace.logger.Error("deserialize tx error", "err", err)
 		return nil, err
 	}
 
 	// Verify
+	_, span := tracing.Start(trace.ctx, "check outputs", attribute.Int("outputs", len(outputs)))
+	err = op.checkOutputs(trace.logger, &msgTx, outputs)
+	tracing.End(span, &err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign
+	signature, err := op.btcVerifier.Sign(trace.ctx, &msgTx)
+	if err != nil {
+		trace.logger.Error("sign tx error", "err", err)
+		return nil, err
+	}
+	if err := op.auditSignature(trace, &msgTx, outputs); err != nil {
+		return nil, err
+	}
+
+	return signature, nil
+}
+
+// checkOutputs makes sure msgTx pays every output.
+func (op *Operator) checkOutputs(logger *slog.Logger, msgTx *wire.MsgTx, outputs []types.Utxo) error {
 	allHasUtxo := 0
 	for _, output := range outputs {
 		for _, uxto := range msgTx.TxOut {
 			receiver, err := op.btcVerifier.ConvertToAddress(uxto.PkScript)
 			if err != nil {
-				op.logger.Error("convert to address error", "err", err)
-				return nil, err
+				logger.Error("convert to address error", "err", err)
+				return err
 			}
 			if output.Address == receiver && output.Amount == uxto.Value {
 				allHasUtxo++
@@ -315,16 +721,8 @@ func (op *Operator) verifyAndSignBtc(txContext string, outputs []types.Utxo) ([]
 		}
 	}
 	if allHasUtxo != len(outputs) {
-		op.logger.Error("not all outputs has utxo")
-		return nil, err
-	}
-
-	// Sign
-	signature, err := op.btcVerifier.Sign(&msgTx)
-	if err != nil {
-		op.logger.Error("sign tx error", "err", err)
-		return nil, err
+		logger.Error("not all outputs has utxo")
+		return fmt.Errorf("%w: %d of %d outputs paid", errOutputsMismatch, allHasUtxo, len(outputs))
 	}
-
-	return signature, nil
+	return nil
 }
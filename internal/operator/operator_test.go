@@ -0,0 +1,129 @@
+package operator_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+var recipient = common.HexToAddress("0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A")
+
+// testConfig returns the config of an operator with fresh keys, checking
+// bitcoin against bitcoind.
+func testConfig(t *testing.T, bitcoind *bitcointest.Bitcoind) *config.Config {
+	evmKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	btcKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	wif, err := btcutil.NewWIF(btcKey, &chaincfg.RegressionNetParams, true)
+	require.NoError(t, err)
+	multisig, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(btcKey.PubKey().SerializeCompressed()), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Server: config.ServerInfo{HttpPort: "0"},
+		Evm: config.EvmInfo{
+			QueryInterval: 1,
+			PrivateKey:    hex.EncodeToString(crypto.FromECDSA(evmKey)),
+		},
+		Bitcoin: config.BitcoinInfo{
+			Network:          config.NetworkRegtest,
+			MultisigAddress:  multisig.EncodeAddress(),
+			RedeemScript:     "51",
+			PrivateKey:       wif.String(),
+			MinConfirmations: 2,
+		},
+	}
+	bitcoind.Configure(&cfg.Bitcoin)
+	return cfg
+}
+
+func evmAddress(t *testing.T, cfg *config.Config) common.Address {
+	key, err := crypto.HexToECDSA(cfg.Evm.PrivateKey)
+	require.NoError(t, err)
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func payTo(t *testing.T, tx *wire.MsgTx, address string, amount int64) {
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+}
+
+func newTx(prev byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{prev}}, nil, nil))
+	return tx
+}
+
+func utxoOf(tx *wire.MsgTx, amount uint64) string {
+	utxo := bitcoin.UtxoDef{TxHash: tx.TxHash().String(), Amount: amount, Receiver: recipient.Hex()}
+	return utxo.String()
+}
+
+func TestOperatorEndToEnd(t *testing.T) {
+	bitcoind := bitcointest.NewBitcoind(&chaincfg.RegressionNetParams)
+	defer bitcoind.Close()
+	cfg := testConfig(t, bitcoind)
+	address := evmAddress(t, cfg)
+	gateway := evmtest.NewGateway(1, address)
+
+	// A confirmed deposit, and an invoice claiming more than it pays
+	deposit := newTx(1)
+	payTo(t, deposit, cfg.Bitcoin.MultisigAddress, 1000)
+	bitcoind.AddTransaction(deposit, 1)
+	bitcoind.Mine(2)
+	valid := gateway.AddIncomingInvoice(utxoOf(deposit, 1000), big.NewInt(1000), recipient)
+	invalid := gateway.AddIncomingInvoice(utxoOf(deposit, 2000), big.NewInt(2000), recipient)
+
+	// A withdrawal paying its invoice
+	withdrawal := newTx(2)
+	payTo(t, withdrawal, "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", 500)
+	var raw bytes.Buffer
+	require.NoError(t, withdrawal.Serialize(&raw))
+	outgoingInvoice := gateway.AddOutgoingInvoice(recipient, big.NewInt(500), "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080")
+	outgoingTx := gateway.AddOutgoingTx(hex.EncodeToString(raw.Bytes()), outgoingInvoice)
+
+	btcVerifier, err := bitcoin.NewVerifier(slog.Default(), cfg.Bitcoin)
+	require.NoError(t, err)
+	op, err := operator.NewOperatorWithVerifiers(context.Background(), cfg, slog.Default(), gateway.Verifier(address), btcVerifier)
+	require.NoError(t, err)
+	op.Start()
+	defer op.Stop(context.Background())
+
+	require.Eventually(t, func() bool {
+		return len(gateway.Votes()) == 3
+	}, 10*time.Second, 100*time.Millisecond)
+
+	require.Equal(t, uint8(evm.Minted), gateway.IncomingInvoice(valid).Status)
+	require.Equal(t, uint8(evm.Refunding), gateway.IncomingInvoice(invalid).Status)
+	tx := gateway.OutgoingTx(outgoingTx)
+	require.Equal(t, uint8(evm.Paid), tx.Status)
+	require.NotEmpty(t, tx.Signatures[0])
+
+	// Each invoice and tx got exactly one vote
+	time.Sleep(1500 * time.Millisecond)
+	require.Len(t, gateway.Votes(), 3)
+}
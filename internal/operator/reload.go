@@ -0,0 +1,158 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of events an editor emits on save.
+const reloadDebounce = 500 * time.Millisecond
+
+// ConfigStatus describes the config in use, served on /status.
+type ConfigStatus struct {
+	Version    string    `json:"version"`
+	Reloads    int       `json:"reloads"`
+	ReloadedAt time.Time `json:"reloaded_at"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// configReloader watches the config file and applies live fields to the
+// operator, see config.Diff.
+type configReloader struct {
+	op    *Operator
+	path  string
+	level *slog.LevelVar
+
+	mu         sync.RWMutex
+	reloads    int
+	reloadedAt time.Time
+	lastError  string
+}
+
+// EnableReload makes Start watch the config file at path and apply changes
+// to live fields. level, when not nil, follows the configured log level.
+func (op *Operator) EnableReload(path string, level *slog.LevelVar) {
+	op.reloader = &configReloader{op: op, path: path, level: level}
+}
+
+// configStatus implements the config section of Status.
+func (op *Operator) configStatus() ConfigStatus {
+	status := ConfigStatus{Version: op.Config().Version}
+	if op.reloader == nil {
+		return status
+	}
+	op.reloader.mu.RLock()
+	defer op.reloader.mu.RUnlock()
+	status.Reloads = op.reloader.reloads
+	status.ReloadedAt = op.reloader.reloadedAt
+	status.LastError = op.reloader.lastError
+	return status
+}
+
+func (r *configReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directory, editors and config management tools replace the
+	// file rather than write it in place.
+	if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+		return err
+	}
+	r.op.logger.Info("watching config file", "path", r.path)
+
+	name := filepath.Clean(r.path)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("config watcher closed")
+			}
+			if filepath.Clean(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create) {
+				debounce = time.After(reloadDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("config watcher closed")
+			}
+			r.op.logger.Error("config watcher error", "err", err)
+		case <-debounce:
+			debounce = nil
+			r.reload()
+		}
+	}
+}
+
+// reload loads and validates the config file and applies it when only live
+// fields changed.
+func (r *configReloader) reload() error {
+	next, err := config.LoadConfig(r.path)
+	if err != nil {
+		r.op.logger.Error("config reload failed", "path", r.path, "err", err)
+		return r.fail(err)
+	}
+
+	current := r.op.Config()
+	if next.Version == current.Version {
+		return nil
+	}
+	live, immutable := config.Diff(current, &next)
+	if len(immutable) > 0 {
+		r.op.logger.Error("config reload refused, restart to apply", "version", next.Version, "immutable", immutable)
+		return r.fail(fmt.Errorf("fields need a restart: %s", strings.Join(immutable, ", ")))
+	}
+
+	if err := r.op.applyConfig(&next); err != nil {
+		r.op.logger.Error("config reload failed", "version", next.Version, "err", err)
+		return r.fail(err)
+	}
+	if r.level != nil {
+		level, _ := next.Log.SlogLevel()
+		r.level.Set(level)
+	}
+
+	r.mu.Lock()
+	r.reloads++
+	r.reloadedAt = time.Now()
+	r.lastError = ""
+	r.mu.Unlock()
+	r.op.logger.Info("config reloaded", "version", next.Version, "fields", live)
+	return nil
+}
+
+func (r *configReloader) fail(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastError = err.Error()
+	return err
+}
+
+// applyConfig pushes the live fields of next to the operator components and
+// makes next the config in use.
+func (op *Operator) applyConfig(next *config.Config) error {
+	if err := op.balance.UpdateConfig(next.Evm); err != nil {
+		return err
+	}
+	if v, ok := op.evmVerifier.(interface{ UpdateConfig(config.EvmInfo) }); ok {
+		v.UpdateConfig(next.Evm)
+	}
+	if v, ok := op.btcVerifier.(interface{ UpdateConfig(config.BitcoinInfo) }); ok {
+		v.UpdateConfig(next.Bitcoin)
+	}
+	op.config.Store(next)
+	return nil
+}
@@ -0,0 +1,55 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBalanceSource struct{}
+
+func (fakeBalanceSource) GetBalance(context.Context) (*big.Int, error)  { return big.NewInt(0), nil }
+func (fakeBalanceSource) GetGasPrice(context.Context) (*big.Int, error) { return big.NewInt(0), nil }
+
+func TestReloadConfig(t *testing.T) {
+	bz, err := os.ReadFile("../../operator.toml")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "operator.toml")
+	require.NoError(t, os.WriteFile(path, bz, 0o600))
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	op := newStoppableOperator(t)
+	op.config.Store(&cfg)
+	op.balance, err = evm.NewBalanceMonitor(op.logger, cfg.Evm, fakeBalanceSource{})
+	require.NoError(t, err)
+	level := new(slog.LevelVar)
+	op.EnableReload(path, level)
+
+	// Live fields are applied
+	live := bytes.Replace(bz, []byte("query-interval = 6\n"), []byte("query-interval = 12\n"), 1)
+	live = append([]byte("[log]\nlevel = \"debug\"\n"), live...)
+	require.NoError(t, os.WriteFile(path, live, 0o600))
+	require.NoError(t, op.reloader.reload())
+	require.Equal(t, int64(12), op.Config().Evm.QueryInterval)
+	require.Equal(t, slog.LevelDebug, level.Level())
+	status := op.configStatus()
+	require.Equal(t, 1, status.Reloads)
+	require.NotEqual(t, cfg.Version, status.Version)
+
+	// Immutable fields are refused and the running config is kept
+	immutable := bytes.Replace(live, []byte("chain-id = 1235"), []byte("chain-id = 1"), 1)
+	require.NoError(t, os.WriteFile(path, immutable, 0o600))
+	require.ErrorContains(t, op.reloader.reload(), "evm.chain-id")
+	require.Equal(t, int64(1235), op.Config().Evm.ChainID)
+	require.Equal(t, status.Version, op.configStatus().Version)
+	require.Contains(t, op.configStatus().LastError, "evm.chain-id")
+}
@@ -0,0 +1,176 @@
+package operator
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+)
+
+const (
+	outcomeAccepted = "accepted"
+	outcomeRejected = "rejected"
+	outcomePending  = "pending"
+)
+
+// ReplayResult compares the verdict replayed for one invoice with what the
+// gateway recorded for it.
+type ReplayResult struct {
+	InvoiceRecord
+	Status  uint8  `json:"status"`
+	Outcome string `json:"outcome"`
+	Voted   bool   `json:"voted"`
+	// Vote is the verdict we voted, when the gateway shows it: our signature
+	// or rejection of an outgoing tx. For an incoming invoice it shows only
+	// that we voted
+	Vote string `json:"vote,omitempty"`
+	// Confirmations tells, for every other validator, whether it confirmed
+	// the invoice on chain
+	Confirmations     map[string]bool `json:"confirmations,omitempty"`
+	Signature         string          `json:"signature,omitempty"`
+	RecordedSignature string          `json:"recorded_signature,omitempty"`
+	Diff              string          `json:"diff,omitempty"`
+}
+
+// Replay re-runs verification of the incoming invoices, or outgoing txs,
+// with ids from..to and compares each verdict with the outcome recorded on
+// the gateway. Nothing is sent: no vote, no record on the status tracker.
+func (op *Operator) Replay(outgoing bool, from, to uint64) ([]ReplayResult, error) {
+	if from == 0 || to < from {
+		return nil, fmt.Errorf("invalid id range %d..%d", from, to)
+	}
+	results := make([]ReplayResult, 0, to-from+1)
+	for id := from; id <= to; id++ {
+		var (
+			result ReplayResult
+			err    error
+		)
+		if outgoing {
+			result, err = op.replayOutgoing(id)
+		} else {
+			result, err = op.replayIncoming(id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (op *Operator) replayIncoming(id uint64) (ReplayResult, error) {
+	trace := op.traceInvoice(directionIncoming, id)
+	trace.begin(time.Now())
+	invoice, err := op.evmVerifier.GetIncomingInvoice(trace.ctx, id)
+	if err != nil {
+		trace.fail(err)
+		return ReplayResult{}, fmt.Errorf("get incoming invoice %d: %w", id, err)
+	}
+	record, _ := op.verifyIncoming(trace, id, invoice)
+	trace.end(record)
+	result := ReplayResult{InvoiceRecord: record}
+	op.settleIncoming(&result, invoice)
+	return result, nil
+}
+
+// settleIncoming fills in result with what the gateway recorded for invoice
+// and how the verdict disagrees with it.
+func (op *Operator) settleIncoming(result *ReplayResult, invoice contracts.IGatewayIncomingInvoiceResponse) {
+	result.Status = invoice.Status
+	result.Outcome = replayOutcome(evm.InvoiceStatus(invoice.Status))
+	result.Voted = op.isVerified(invoice)
+	result.Confirmations = make(map[string]bool)
+	for index, address := range invoice.Validators {
+		if address != op.evmVerifier.GetAddress() && index < len(invoice.Confirmations) {
+			result.Confirmations[address.Hex()] = invoice.Confirmations[index]
+		}
+	}
+	result.Diff = replayDiff(*result)
+}
+
+func (op *Operator) replayOutgoing(id uint64) (ReplayResult, error) {
+	trace := op.traceInvoice(directionOutgoing, id)
+	trace.begin(time.Now())
+	tx, err := op.evmVerifier.GetOutgoingTx(trace.ctx, new(big.Int).SetUint64(id))
+	if err != nil {
+		trace.fail(err)
+		return ReplayResult{}, fmt.Errorf("get outgoing tx %d: %w", id, err)
+	}
+	record, signature := op.verifyOutgoing(trace, id, tx, true)
+	trace.end(record)
+	result := ReplayResult{InvoiceRecord: record}
+	if signature != nil {
+		result.Signature = hex.EncodeToString(signature)
+	}
+	op.settleOutgoing(&result, tx)
+	return result, nil
+}
+
+// settleOutgoing fills in result with what the gateway recorded for tx and
+// how the verdict and signature disagree with it.
+func (op *Operator) settleOutgoing(result *ReplayResult, tx contracts.IGatewayOutgoingTxInfo) {
+	result.Status = tx.Status
+	result.Outcome = replayOutcome(evm.InvoiceStatus(tx.Status))
+	result.Confirmations = make(map[string]bool)
+	for index, address := range tx.Validators {
+		if index >= len(tx.Signatures) {
+			break
+		}
+		if address != op.evmVerifier.GetAddress() {
+			result.Confirmations[address.Hex()] = isSignature(tx.Signatures[index])
+			continue
+		}
+		result.RecordedSignature = tx.Signatures[index]
+		result.Voted = result.RecordedSignature != ""
+		switch {
+		case isSignature(result.RecordedSignature):
+			result.Vote = verdictValid
+		case result.Voted:
+			result.Vote = verdictInvalid
+		}
+	}
+	result.Diff = replayDiff(*result)
+	if result.Diff == "" && result.Verdict == verdictValid && result.RecordedSignature != "" &&
+		result.RecordedSignature != result.Signature {
+		result.Diff = "signature differs from the recorded one"
+	}
+}
+
+// isSignature reports whether a signature slot of an outgoing tx holds a
+// signature, rather than nothing or a rejection.
+func isSignature(s string) bool {
+	sig, err := hex.DecodeString(s)
+	return err == nil && len(sig) > 0
+}
+
+// replayOutcome maps a gateway status onto whether validators accepted the
+// invoice, which is all the gateway records of their votes.
+func replayOutcome(status evm.InvoiceStatus) string {
+	switch status {
+	case evm.Minted, evm.Paid:
+		return outcomeAccepted
+	case evm.Refunding, evm.Refunded, evm.Manual:
+		return outcomeRejected
+	default:
+		return outcomePending
+	}
+}
+
+// replayDiff describes how a replayed verdict disagrees with the recorded
+// outcome or with our own vote, empty when it does not.
+func replayDiff(result ReplayResult) string {
+	switch {
+	case result.Verdict == verdictError:
+		return "verification failed: " + result.Error
+	case result.Outcome == outcomeAccepted && result.Verdict != verdictValid:
+		return fmt.Sprintf("%s now, accepted on chain", result.Verdict)
+	case result.Outcome == outcomeRejected && result.Verdict == verdictValid:
+		return "valid now, rejected on chain"
+	case result.Vote != "" && result.Verdict != result.Vote:
+		return fmt.Sprintf("%s now, voted %s", result.Verdict, result.Vote)
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package operator
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayIncoming(t *testing.T) {
+	invoices := []contracts.IGatewayIncomingInvoiceResponse{
+		incomingInvoice(1, evm.Minted, true, true),
+		incomingInvoice(2, evm.Refunding, true, true),
+		incomingInvoice(3, evm.Minted, true, true),
+		incomingInvoice(4, evm.Pending, true, false),
+		incomingInvoice(5, evm.Minted, true, true),
+	}
+	invoices[1].Utxo = "bad"
+	invoices[2].Utxo = "bad"
+	invoices[4].Utxo = "unreachable"
+
+	evmVerifier := &evmtest.MockVerifier{}
+	gatewayWith(evmVerifier, 1, invoices...)
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(utxo string, amount uint64, recipient string) (bool, int64, error) {
+			if utxo == "unreachable" {
+				return false, 0, errRPC
+			}
+			return utxo != "bad", 6, nil
+		},
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+
+	results, err := op.Replay(false, 1, 5)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	want := []struct {
+		verdict string
+		outcome string
+		voted   bool
+		diff    string
+	}{
+		{verdictValid, outcomeAccepted, true, ""},
+		{verdictInvalid, outcomeRejected, true, ""},
+		{verdictInvalid, outcomeAccepted, true, "invalid now, accepted on chain"},
+		{verdictValid, outcomePending, false, ""},
+		{verdictError, outcomeAccepted, true, "verification failed: " + errRPC.Error()},
+	}
+	for i, w := range want {
+		require.Equal(t, uint64(i+1), results[i].Id)
+		require.Equal(t, w.verdict, results[i].Verdict, "id %d", i+1)
+		require.Equal(t, w.outcome, results[i].Outcome, "id %d", i+1)
+		require.Equal(t, w.voted, results[i].Voted, "id %d", i+1)
+		require.Equal(t, w.diff, results[i].Diff, "id %d", i+1)
+	}
+
+	require.Zero(t, evmVerifier.Calls("VerifyIncomingInvoice"))
+	require.Empty(t, op.IncomingInvoices())
+}
+
+func TestReplayOutgoing(t *testing.T) {
+	paidTx := func(t *testing.T, recorded string) contracts.IGatewayOutgoingTxInfo {
+		return contracts.IGatewayOutgoingTxInfo{
+			TxId:       big.NewInt(1),
+			InvoiceIds: []*big.Int{big.NewInt(1)},
+			TxContent:  withdrawalTx(t, 500),
+			Validators: []common.Address{other, self},
+			Signatures: []string{"cd", recorded},
+			Status:     uint8(evm.Paid),
+		}
+	}
+	tests := []struct {
+		name     string
+		recorded string
+		diff     string
+	}{
+		{"same signature", "ab", ""},
+		{"other signature", "ef", "signature differs from the recorded one"},
+		{"not voted", "", ""},
+		{"rejected", "-", "valid now, voted invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := paidTx(t, tt.recorded)
+			evmVerifier := &evmtest.MockVerifier{
+				GetOutgoingTxFn: func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil },
+				GetOutgoingInvoiceFn: func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+					return contracts.IGatewayOutgoingInvoiceResponse{
+						InvoiceId: big.NewInt(1),
+						Amount:    big.NewInt(500),
+						Recipient: withdrawalAddr,
+						Status:    uint8(evm.Paid),
+					}, nil
+				},
+			}
+			btcVerifier := &bitcointest.MockVerifier{
+				ConvertToAddressFn: regtestAddress,
+				SignFn:             func(*wire.MsgTx) ([]byte, error) { return []byte{0xab}, nil },
+			}
+			op := newScenarioOperator(t, evmVerifier, btcVerifier)
+
+			results, err := op.Replay(true, 1, 1)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, verdictValid, results[0].Verdict)
+			require.Equal(t, outcomeAccepted, results[0].Outcome)
+			require.Equal(t, "ab", results[0].Signature)
+			require.Equal(t, tt.recorded != "", results[0].Voted)
+			require.Equal(t, tt.diff, results[0].Diff)
+			require.Zero(t, evmVerifier.Calls("VerifyOutgoingTx"))
+		})
+	}
+}
+
+func TestReplayInvalidRange(t *testing.T) {
+	op := newScenarioOperator(t, &evmtest.MockVerifier{}, &bitcointest.MockVerifier{})
+	_, err := op.Replay(false, 0, 1)
+	require.Error(t, err)
+	_, err = op.Replay(false, 3, 2)
+	require.Error(t, err)
+}
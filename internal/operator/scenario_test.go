@@ -0,0 +1,559 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/aura-nw/lotus-operator/internal/operator/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	self  = common.HexToAddress("0x0000000000000000000000000000000000000001")
+	other = common.HexToAddress("0x0000000000000000000000000000000000000002")
+
+	errRPC = errors.New("connection refused")
+
+	withdrawalAddr = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+)
+
+func newScenarioOperator(t *testing.T, evmVerifier *evmtest.MockVerifier, btcVerifier *bitcointest.MockVerifier) *Operator {
+	evmVerifier.Address = self
+	cfg := &config.Config{
+		Server: config.ServerInfo{HttpPort: "0"},
+		Evm:    config.EvmInfo{QueryInterval: 1},
+	}
+	op, err := NewOperatorWithVerifiers(context.Background(), cfg, slog.Default(), evmVerifier, btcVerifier)
+	require.NoError(t, err)
+	t.Cleanup(op.cancel)
+	return op
+}
+
+func incomingInvoice(id uint64, status evm.InvoiceStatus, confirmations ...bool) contracts.IGatewayIncomingInvoiceResponse {
+	return contracts.IGatewayIncomingInvoiceResponse{
+		InvoiceId:     new(big.Int).SetUint64(id),
+		Utxo:          "utxo",
+		Amount:        big.NewInt(1000),
+		Recipient:     other,
+		Status:        uint8(status),
+		Validators:    []common.Address{other, self},
+		Confirmations: confirmations,
+	}
+}
+
+// gatewayWith scripts the incoming invoice reads of m.
+func gatewayWith(m *evmtest.MockVerifier, nextId uint64, invoices ...contracts.IGatewayIncomingInvoiceResponse) {
+	m.GetNextIdVerifyIncomingInvoiceFn = func(common.Address) (*big.Int, error) {
+		return new(big.Int).SetUint64(nextId), nil
+	}
+	m.GetIncomingInvoiceCountFn = func() (*big.Int, error) {
+		return big.NewInt(int64(len(invoices))), nil
+	}
+	m.GetIncomingInvoiceFn = func(id uint64) (contracts.IGatewayIncomingInvoiceResponse, error) {
+		return invoices[id-1], nil
+	}
+}
+
+func TestIsVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		invoice  contracts.IGatewayIncomingInvoiceResponse
+		verified bool
+	}{
+		{"confirmed by us", incomingInvoice(1, evm.Pending, false, true), true},
+		{"confirmed by others", incomingInvoice(1, evm.Pending, true, false), false},
+		{"confirmations missing", incomingInvoice(1, evm.Pending, true), false},
+		{"not a validator", contracts.IGatewayIncomingInvoiceResponse{
+			Validators:    []common.Address{other},
+			Confirmations: []bool{true},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := newScenarioOperator(t, &evmtest.MockVerifier{}, &bitcointest.MockVerifier{})
+			require.Equal(t, tt.verified, op.isVerified(tt.invoice))
+		})
+	}
+}
+
+func TestFindNextIncomingIdNeedVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  func(m *evmtest.MockVerifier)
+		voted   uint64
+		id      uint64
+		wantErr bool
+	}{
+		{
+			name: "next id pending",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending))
+			},
+			id: 1,
+		},
+		{
+			name: "skips non-pending statuses",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1,
+					incomingInvoice(1, evm.Minted),
+					incomingInvoice(2, evm.Refunded),
+					incomingInvoice(3, evm.Pending))
+			},
+			id: 3,
+		},
+		{
+			name: "skips already verified",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending, false, true), incomingInvoice(2, evm.Pending))
+			},
+			id: 2,
+		},
+		{
+			name: "skips voted but not confirmed",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending), incomingInvoice(2, evm.Pending))
+			},
+			voted: 1,
+			id:    2,
+		},
+		{
+			name: "nothing to verify",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 2, incomingInvoice(1, evm.Minted))
+			},
+			wantErr: true,
+		},
+		{
+			name: "next id rpc failure",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending))
+				m.GetNextIdVerifyIncomingInvoiceFn = func(common.Address) (*big.Int, error) { return nil, errRPC }
+			},
+			wantErr: true,
+		},
+		{
+			name: "count rpc failure",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending))
+				m.GetIncomingInvoiceCountFn = func() (*big.Int, error) { return nil, errRPC }
+			},
+			wantErr: true,
+		},
+		{
+			name: "invoice rpc failure",
+			script: func(m *evmtest.MockVerifier) {
+				gatewayWith(m, 1, incomingInvoice(1, evm.Pending))
+				m.GetIncomingInvoiceFn = func(uint64) (contracts.IGatewayIncomingInvoiceResponse, error) {
+					return contracts.IGatewayIncomingInvoiceResponse{}, errRPC
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evmVerifier := &evmtest.MockVerifier{}
+			tt.script(evmVerifier)
+			op := newScenarioOperator(t, evmVerifier, &bitcointest.MockVerifier{})
+			if tt.voted != 0 {
+				op.status.markVoted(directionIncoming, tt.voted)
+			}
+
+			id, err := op.findNextIncomingIdNeedVerify()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.id, id)
+		})
+	}
+}
+
+func TestProcessIncoming(t *testing.T) {
+	tests := []struct {
+		name    string
+		deposit func(utxo string, amount uint64, recipient string) (bool, int64, error)
+		vote    error
+		noWork  bool
+		// votes is the expected vote, nil when none is sent
+		votes   *bool
+		verdict string
+		reason  string
+		errMsg  string
+	}{
+		{
+			name:    "valid deposit",
+			deposit: func(string, uint64, string) (bool, int64, error) { return true, 6, nil },
+			votes:   ptr(true),
+			verdict: verdictValid,
+			reason:  reasonDepositVerified,
+		},
+		{
+			name:    "invalid deposit",
+			deposit: func(string, uint64, string) (bool, int64, error) { return false, 6, nil },
+			votes:   ptr(false),
+			verdict: verdictInvalid,
+			reason:  reasonDepositInvalid,
+		},
+		{
+			name:    "deposit lookup failure",
+			deposit: func(string, uint64, string) (bool, int64, error) { return false, 0, errRPC },
+			verdict: verdictError,
+			reason:  reasonDepositLookup,
+			errMsg:  errRPC.Error(),
+		},
+		{
+			name:    "vote failure",
+			deposit: func(string, uint64, string) (bool, int64, error) { return true, 6, nil },
+			vote:    errRPC,
+			votes:   ptr(true),
+			verdict: verdictValid,
+			reason:  reasonDepositVerified,
+			errMsg:  "vote failed: " + errRPC.Error(),
+		},
+		{
+			name:   "no invoice",
+			noWork: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evmVerifier := &evmtest.MockVerifier{}
+			if tt.noWork {
+				gatewayWith(evmVerifier, 1)
+			} else {
+				gatewayWith(evmVerifier, 1, incomingInvoice(1, evm.Pending))
+			}
+			var voted *bool
+			evmVerifier.VerifyIncomingInvoiceFn = func(id uint64, utxo string, amount *big.Int, recipient common.Address, isVerified bool) (common.Hash, error) {
+				voted = &isVerified
+				return common.Hash{1}, tt.vote
+			}
+			btcVerifier := &bitcointest.MockVerifier{VerifyBtcDepositFn: tt.deposit}
+			op := newScenarioOperator(t, evmVerifier, btcVerifier)
+
+			err := op.processIncoming()
+			require.Equal(t, tt.votes, voted)
+			if tt.noWork {
+				require.Error(t, err)
+				require.Empty(t, op.IncomingInvoices())
+				return
+			}
+			require.NoError(t, err)
+			records := op.IncomingInvoices()
+			require.Len(t, records, 1)
+			require.Equal(t, tt.verdict, records[0].Verdict)
+			require.Equal(t, tt.reason, records[0].Reason)
+			require.Equal(t, tt.errMsg, records[0].Error)
+		})
+	}
+}
+
+func TestProcessIncomingRetryCountedOnce(t *testing.T) {
+	evmVerifier := &evmtest.MockVerifier{
+		VerifyIncomingInvoiceFn: func(uint64, string, *big.Int, common.Address, bool) (common.Hash, error) {
+			return common.Hash{1}, nil
+		},
+	}
+	gatewayWith(evmVerifier, 1, incomingInvoice(1, evm.Pending))
+	depositErr := errRPC
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(string, uint64, string) (bool, int64, error) { return depositErr == nil, 6, depositErr },
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+
+	failed := metrics.Verdicts.WithLabelValues(directionIncoming, verdictError, reasonDepositLookup)
+	valid := metrics.Verdicts.WithLabelValues(directionIncoming, verdictValid, reasonDepositVerified)
+	failedBefore, validBefore := testutil.ToFloat64(failed), testutil.ToFloat64(valid)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, op.processIncoming())
+	}
+	require.Equal(t, failedBefore+1, testutil.ToFloat64(failed))
+
+	depositErr = nil
+	require.NoError(t, op.processIncoming())
+	require.Equal(t, validBefore+1, testutil.ToFloat64(valid))
+	require.Len(t, op.IncomingInvoices(), 1)
+}
+
+// withdrawalTx returns the hex of a tx paying amount to withdrawalAddr.
+func withdrawalTx(t *testing.T, amount int64) string {
+	addr, err := btcutil.DecodeAddress(withdrawalAddr, &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	var raw bytes.Buffer
+	require.NoError(t, tx.Serialize(&raw))
+	return hex.EncodeToString(raw.Bytes())
+}
+
+func regtestAddress(pkScript []byte) (string, error) {
+	pk, err := txscript.ParsePkScript(pkScript)
+	if err != nil {
+		return "", err
+	}
+	addr, err := pk.Address(&chaincfg.RegressionNetParams)
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
+}
+
+func TestProcessOutgoing(t *testing.T) {
+	pendingTx := func(t *testing.T) contracts.IGatewayOutgoingTxInfo {
+		return contracts.IGatewayOutgoingTxInfo{
+			TxId:       big.NewInt(1),
+			InvoiceIds: []*big.Int{big.NewInt(1)},
+			TxContent:  withdrawalTx(t, 500),
+			Status:     uint8(evm.Pending),
+		}
+	}
+	invoice := contracts.IGatewayOutgoingInvoiceResponse{
+		InvoiceId: big.NewInt(1),
+		Amount:    big.NewInt(500),
+		Recipient: withdrawalAddr,
+		Status:    uint8(evm.Pending),
+	}
+
+	tests := []struct {
+		name   string
+		script func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier)
+		voted  bool
+		// votes is the expected vote, nil when none is sent
+		votes *bool
+		// pending is whether a sent vote is still awaited on the gateway
+		pending bool
+		signs   bool
+		verdict string
+		reason  string
+	}{
+		{
+			name:    "outputs match",
+			votes:   ptr(true),
+			pending: true,
+			signs:   true,
+			verdict: verdictValid,
+			reason:  reasonOutputsVerified,
+		},
+		{
+			name: "no outgoing tx",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.GetOutgoingTxCountFn = func() (*big.Int, error) { return big.NewInt(0), nil }
+			},
+		},
+		{
+			name: "count rpc failure",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.GetOutgoingTxCountFn = func() (*big.Int, error) { return nil, errRPC }
+			},
+		},
+		{
+			name: "tx rpc failure",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.GetOutgoingTxFn = func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) {
+					return contracts.IGatewayOutgoingTxInfo{}, errRPC
+				}
+			},
+		},
+		{
+			name: "tx not pending",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				tx := pendingTx(t)
+				tx.Status = uint8(evm.Paid)
+				e.GetOutgoingTxFn = func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil }
+			},
+		},
+		{
+			name:    "already voted",
+			voted:   true,
+			pending: true,
+		},
+		{
+			name: "vote shown on gateway",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				tx := pendingTx(t)
+				tx.Validators = []common.Address{self}
+				tx.Signatures = []string{"ab"}
+				e.GetOutgoingTxFn = func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil }
+			},
+			voted: true,
+		},
+		{
+			name: "rejection shown on gateway",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				tx := pendingTx(t)
+				tx.Validators = []common.Address{self}
+				tx.Signatures = []string{""}
+				e.GetOutgoingTxFn = func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil }
+				e.GetNextIdVerifyOutgoingInvoiceFn = func(common.Address) (*big.Int, error) { return big.NewInt(2), nil }
+			},
+			voted: true,
+		},
+		{
+			name: "cursor rpc failure",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.GetNextIdVerifyOutgoingInvoiceFn = func(common.Address) (*big.Int, error) { return nil, errRPC }
+			},
+		},
+		{
+			name: "vote not mined in time",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.VerifyOutgoingTxFn = func(uint64, bool, string) (common.Hash, error) {
+					return common.Hash{1}, errors.New("wait mined: context deadline exceeded")
+				}
+			},
+			signs:   true,
+			pending: true,
+			verdict: verdictValid,
+			reason:  reasonOutputsVerified,
+		},
+		{
+			name: "mismatched outputs",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				tx := pendingTx(t)
+				tx.TxContent = withdrawalTx(t, 400)
+				e.GetOutgoingTxFn = func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil }
+			},
+			votes:   ptr(false),
+			pending: true,
+			verdict: verdictInvalid,
+			reason:  reasonOutputsMismatch,
+		},
+		{
+			name: "signing error",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				b.SignFn = func(*wire.MsgTx) ([]byte, error) { return nil, errors.New("bad key") }
+			},
+			signs:   true,
+			verdict: verdictError,
+			reason:  reasonVerifyAndSignBtc,
+		},
+		{
+			name: "invoice rpc failure",
+			script: func(t *testing.T, e *evmtest.MockVerifier, b *bitcointest.MockVerifier) {
+				e.GetOutgoingInvoiceFn = func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+					return contracts.IGatewayOutgoingInvoiceResponse{}, errRPC
+				}
+			},
+			votes:   ptr(false),
+			pending: true,
+			verdict: verdictInvalid,
+			reason:  reasonInvoiceLookup,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := pendingTx(t)
+			evmVerifier := &evmtest.MockVerifier{
+				GetOutgoingTxCountFn:             func() (*big.Int, error) { return big.NewInt(1), nil },
+				GetOutgoingTxFn:                  func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil },
+				GetOutgoingInvoiceFn:             func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) { return invoice, nil },
+				GetNextIdVerifyOutgoingInvoiceFn: func(common.Address) (*big.Int, error) { return big.NewInt(1), nil },
+			}
+			var voted *bool
+			var signature string
+			evmVerifier.VerifyOutgoingTxFn = func(id uint64, isVerified bool, sig string) (common.Hash, error) {
+				voted, signature = &isVerified, sig
+				return common.Hash{1}, nil
+			}
+			btcVerifier := &bitcointest.MockVerifier{
+				ConvertToAddressFn: regtestAddress,
+				SignFn:             func(*wire.MsgTx) ([]byte, error) { return []byte{0xab}, nil },
+			}
+			if tt.script != nil {
+				tt.script(t, evmVerifier, btcVerifier)
+			}
+			op := newScenarioOperator(t, evmVerifier, btcVerifier)
+			if tt.voted {
+				op.status.markVoted(directionOutgoing, 1)
+			}
+
+			op.processOutgoing()
+			require.Equal(t, tt.votes, voted)
+			require.Equal(t, tt.pending, op.status.voted(directionOutgoing, 1))
+			if tt.votes != nil && *tt.votes {
+				require.Equal(t, "ab", signature)
+			}
+			require.Equal(t, tt.signs, btcVerifier.Calls("Sign") > 0)
+
+			records := op.OutgoingInvoices()
+			if tt.verdict == "" {
+				require.Empty(t, records)
+				return
+			}
+			require.Equal(t, tt.verdict, records[0].Verdict)
+			require.Equal(t, tt.reason, records[0].Reason)
+		})
+	}
+}
+
+func TestVerifyAndSignBtc(t *testing.T) {
+	outputs := []types.Utxo{{Address: withdrawalAddr, Amount: 500}}
+	tests := []struct {
+		name    string
+		tx      string
+		outputs []types.Utxo
+		sign    func(*wire.MsgTx) ([]byte, error)
+		wantErr error
+	}{
+		{"signed", withdrawalTx(t, 500), outputs, nil, nil},
+		{"no outputs", withdrawalTx(t, 500), nil, nil, nil},
+		{"mismatched amount", withdrawalTx(t, 400), outputs, nil, errOutputsMismatch},
+		{"mismatched address", withdrawalTx(t, 500), []types.Utxo{{Address: "bcrt1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qzf4jqq", Amount: 500}}, nil, errOutputsMismatch},
+		{"signing error", withdrawalTx(t, 500), outputs, func(*wire.MsgTx) ([]byte, error) { return nil, errRPC }, errRPC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sign := tt.sign
+			if sign == nil {
+				sign = func(*wire.MsgTx) ([]byte, error) { return []byte{0xab}, nil }
+			}
+			op := newScenarioOperator(t, &evmtest.MockVerifier{}, &bitcointest.MockVerifier{
+				ConvertToAddressFn: regtestAddress,
+				SignFn:             sign,
+			})
+			signature, err := op.verifyAndSignBtc(op.traceInvoice(directionOutgoing, 1), tt.tx, tt.outputs)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.Nil(t, signature)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []byte{0xab}, signature)
+		})
+	}
+
+	t.Run("malformed tx", func(t *testing.T) {
+		op := newScenarioOperator(t, &evmtest.MockVerifier{}, &bitcointest.MockVerifier{})
+		_, err := op.verifyAndSignBtc(op.traceInvoice(directionOutgoing, 1), "zz", outputs)
+		require.Error(t, err)
+		_, err = op.verifyAndSignBtc(op.traceInvoice(directionOutgoing, 1), "00", outputs)
+		require.Error(t, err)
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -2,25 +2,42 @@ package operator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
 	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+	"github.com/ethereum/go-ethereum/common"
 )
 
+// StatusProvider exposes the operator state served by the HTTP API.
+type StatusProvider interface {
+	Status() Status
+	IncomingInvoices() []InvoiceRecord
+	OutgoingInvoices() []InvoiceRecord
+	Operators() ([]common.Address, error)
+	Liveness() HealthReport
+	Readiness() HealthReport
+}
+
 type Server struct {
-	ctx    context.Context
-	logger *slog.Logger
-	info   config.ServerInfo
+	ctx      context.Context
+	logger   *slog.Logger
+	info     config.ServerInfo
+	provider StatusProvider
 
 	srv *http.Server
 }
 
-func NewServer(ctx context.Context, logger *slog.Logger, info config.ServerInfo) (*Server, error) {
+func NewServer(ctx context.Context, logger *slog.Logger, info config.ServerInfo, provider StatusProvider) (*Server, error) {
 	s := &Server{
-		logger: logger,
-		info:   info,
+		ctx:      ctx,
+		logger:   logger,
+		info:     info,
+		provider: provider,
 	}
 
 	mux := http.NewServeMux()
@@ -40,16 +57,75 @@ func (s *Server) registerHandlers(mux *http.ServeMux) {
 			s.logger.Error("write data to client error", "err", err)
 		}
 	})
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		s.writeHealth(w, s.provider.Liveness())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeHealth(w, s.provider.Readiness())
+	})
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, http.StatusOK, s.provider.Status())
+	})
+	mux.HandleFunc("/invoices/incoming", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, http.StatusOK, s.provider.IncomingInvoices())
+	})
+	mux.HandleFunc("/invoices/outgoing", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, http.StatusOK, s.provider.OutgoingInvoices())
+	})
+	mux.HandleFunc("/shadow", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.provider.(interface{ ShadowReport() (ShadowReport, bool) })
+		if !ok {
+			s.writeJSON(w, http.StatusNotFound, map[string]string{"error": "shadow mode not supported"})
+			return
+		}
+		report, ok := p.ShadowReport()
+		if !ok {
+			s.writeJSON(w, http.StatusNotFound, map[string]string{"error": "operator is not in shadow mode"})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, report)
+	})
+	mux.HandleFunc("/operators", func(w http.ResponseWriter, r *http.Request) {
+		operators, err := s.provider.Operators()
+		if err != nil {
+			s.logger.Error("get operators error", "err", err)
+			s.writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, operators)
+	})
+}
+
+func (s *Server) writeHealth(w http.ResponseWriter, report HealthReport) {
+	code := http.StatusOK
+	if !report.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, code, report)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("write data to client error", "err", err)
+	}
 }
 
-func (s *Server) Start() {
-	if err := s.srv.ListenAndServe(); err != nil {
-		panic(err)
+// Start serves the HTTP API until the server is stopped.
+func (s *Server) Start() error {
+	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("http server error", "err", err)
+		return err
 	}
+	return nil
 }
 
-func (s *Server) Stop() {
-	if err := s.srv.Shutdown(s.ctx); err != nil {
+// Stop gracefully shuts the server down, waiting for active requests until
+// ctx is done.
+func (s *Server) Stop(ctx context.Context) {
+	if err := s.srv.Shutdown(ctx); err != nil {
 		s.logger.Error("shutdown http server error", "err", err)
 	}
 }
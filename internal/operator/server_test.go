@@ -0,0 +1,96 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	ready    HealthReport
+	status   Status
+	incoming []InvoiceRecord
+	outgoing []InvoiceRecord
+}
+
+func (p *fakeProvider) Status() Status                       { return p.status }
+func (p *fakeProvider) IncomingInvoices() []InvoiceRecord    { return p.incoming }
+func (p *fakeProvider) OutgoingInvoices() []InvoiceRecord    { return p.outgoing }
+func (p *fakeProvider) Operators() ([]common.Address, error) { return nil, nil }
+func (p *fakeProvider) Liveness() HealthReport               { return newHealthReport() }
+func (p *fakeProvider) Readiness() HealthReport              { return p.ready }
+
+func serve(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServerStatus(t *testing.T) {
+	provider := &fakeProvider{
+		status: Status{EvmAddress: "0x01", EvmHeight: 10, BtcHeight: 20},
+		incoming: []InvoiceRecord{
+			{Id: 1, Direction: directionIncoming, Verdict: verdictValid, VoteTxHash: "0xabc"},
+		},
+	}
+	s, err := NewServer(context.Background(), slog.Default(), config.ServerInfo{HttpPort: "0"}, provider)
+	require.NoError(t, err)
+
+	rec := serve(t, s, "/status")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, provider.status.EvmAddress, status.EvmAddress)
+	require.Equal(t, provider.status.BtcHeight, status.BtcHeight)
+
+	rec = serve(t, s, "/invoices/incoming")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var records []InvoiceRecord
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &records))
+	require.Len(t, records, 1)
+	require.Equal(t, "0xabc", records[0].VoteTxHash)
+}
+
+func TestStatusTrackerRecent(t *testing.T) {
+	tracker := newStatusTracker()
+	for i := 0; i < maxRecentInvoices+5; i++ {
+		tracker.record(InvoiceRecord{Id: uint64(i), Direction: directionIncoming})
+	}
+	tracker.record(InvoiceRecord{Id: 1, Direction: directionOutgoing})
+
+	incoming := tracker.recent(directionIncoming)
+	require.Len(t, incoming, maxRecentInvoices)
+	require.Equal(t, uint64(maxRecentInvoices+4), incoming[0].Id)
+	require.Len(t, tracker.recent(directionOutgoing), 1)
+}
+
+func TestServerReadiness(t *testing.T) {
+	provider := &fakeProvider{
+		ready: newHealthReport(
+			healthy("evm", "head 10"),
+			unhealthy("bitcoin", errors.New("initial block download in progress")),
+		),
+	}
+	s, err := NewServer(context.Background(), slog.Default(), config.ServerInfo{HttpPort: "0"}, provider)
+	require.NoError(t, err)
+
+	rec := serve(t, s, "/livez")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.False(t, report.Healthy)
+	require.Len(t, report.Checks, 2)
+	require.False(t, report.Checks[1].Healthy)
+}
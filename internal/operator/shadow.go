@@ -0,0 +1,298 @@
+package operator
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/aura-nw/lotus-operator/internal/metrics"
+)
+
+// ShadowDisagreement is a shadow verdict at odds with the chain.
+type ShadowDisagreement struct {
+	ReplayResult
+	// Validators lists the validators that confirmed an invoice the
+	// verdict rejects
+	Validators []string `json:"validators,omitempty"`
+}
+
+// ShadowReport is the progress of an operator in shadow mode, served on
+// /shadow.
+type ShadowReport struct {
+	NextIncoming  uint64               `json:"next_incoming"`
+	NextOutgoing  uint64               `json:"next_outgoing"`
+	Checked       map[string]int       `json:"checked"`
+	Waiting       map[string]int       `json:"waiting"`
+	Disagreements []ShadowDisagreement `json:"disagreements"`
+}
+
+// shadowState tracks an operator in shadow mode, which verifies invoices
+// as they show up, instead of voting, and compares its verdicts with the
+// votes once the chain settled them. The gateway cursors only move with our
+// own votes, so shadow mode keeps its own.
+type shadowState struct {
+	mu      sync.Mutex
+	next    map[string]uint64
+	checked map[string]int
+	// waiting holds, per direction, the verdicts on invoices the chain has
+	// not settled yet
+	waiting       map[string]map[uint64]ReplayResult
+	disagreements []ShadowDisagreement
+}
+
+func newShadowState() *shadowState {
+	return &shadowState{
+		next:    make(map[string]uint64),
+		checked: make(map[string]int),
+		waiting: map[string]map[uint64]ReplayResult{
+			directionIncoming: make(map[uint64]ReplayResult),
+			directionOutgoing: make(map[uint64]ReplayResult),
+		},
+	}
+}
+
+func (s *shadowState) cursor(direction string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, ok := s.next[direction]
+	return next, ok
+}
+
+func (s *shadowState) advance(direction string, next uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next[direction] = next
+}
+
+// wait keeps the verdict of result until the chain settles its invoice.
+func (s *shadowState) wait(result ReplayResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waiting[result.Direction][result.Id] = result
+}
+
+// waitingOn returns the verdicts of direction waiting for the chain, by id.
+func (s *shadowState) waitingOn(direction string) []ReplayResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]ReplayResult, 0, len(s.waiting[direction]))
+	for _, result := range s.waiting[direction] {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Id < results[j].Id })
+	return results
+}
+
+func (s *shadowState) record(result ReplayResult, disagreement *ShadowDisagreement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.waiting[result.Direction], result.Id)
+	s.checked[result.Direction]++
+	if disagreement != nil {
+		s.disagreements = append(s.disagreements, *disagreement)
+		if len(s.disagreements) > maxRecentInvoices {
+			s.disagreements = s.disagreements[len(s.disagreements)-maxRecentInvoices:]
+		}
+	}
+}
+
+func (s *shadowState) report() ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := ShadowReport{
+		NextIncoming:  s.next[directionIncoming],
+		NextOutgoing:  s.next[directionOutgoing],
+		Checked:       make(map[string]int, len(s.checked)),
+		Waiting:       make(map[string]int, len(s.waiting)),
+		Disagreements: make([]ShadowDisagreement, 0, len(s.disagreements)),
+	}
+	for direction, n := range s.checked {
+		report.Checked[direction] = n
+	}
+	for direction, results := range s.waiting {
+		report.Waiting[direction] = len(results)
+	}
+	// Newest first, like the invoice records
+	for i := len(s.disagreements) - 1; i >= 0; i-- {
+		report.Disagreements = append(report.Disagreements, s.disagreements[i])
+	}
+	return report
+}
+
+// ShadowReport returns the shadow mode progress and disagreements, false
+// when the operator votes.
+func (op *Operator) ShadowReport() (ShadowReport, bool) {
+	if op.shadow == nil {
+		return ShadowReport{}, false
+	}
+	return op.shadow.report(), true
+}
+
+// processShadow verifies, without voting, the invoices or txs of direction
+// past the shadow cursor, and compares the verdicts waiting for the chain
+// with the invoices it settled since. Each invoice is verified when it
+// shows up, and again only while verification fails, so one that never
+// settles does not hold back the others.
+func (op *Operator) processShadow(direction string) {
+	next, err := op.shadowCursor(direction)
+	if err != nil {
+		op.logger.Error("get shadow cursor error", "direction", direction, "err", err)
+		return
+	}
+	count, err := op.shadowCount(direction)
+	if err != nil {
+		op.logger.Error("get count error", "direction", direction, "err", err)
+		return
+	}
+	metrics.SetLoopLag(direction, count, next)
+
+	op.settleShadow(direction)
+	for id := next; id <= count; id++ {
+		var result ReplayResult
+		if direction == directionOutgoing {
+			result, err = op.replayOutgoing(id)
+		} else {
+			result, err = op.replayIncoming(id)
+		}
+		if err != nil {
+			op.logger.Error("shadow verify error", "invoice_id", id, "direction", direction, "err", err)
+			return
+		}
+		op.recordVerdict(result.InvoiceRecord)
+		// A failed verification, say a deposit our node does not see
+		// confirmed yet, is retried before it is held against the chain
+		if result.Outcome == outcomePending || result.Verdict == verdictError {
+			op.invoiceLogger(direction, id, result.CorrelationId).Info("shadow verdict, waiting for the chain", "verdict", result.Verdict)
+			op.shadow.wait(result)
+		} else {
+			op.recordShadow(result)
+		}
+		op.shadow.advance(direction, id+1)
+	}
+}
+
+// settleShadow reads again the gateway state of the invoices or txs of
+// direction waiting for the chain, and records those it settled. Those
+// whose verification failed are verified again first.
+func (op *Operator) settleShadow(direction string) {
+	for _, result := range op.shadow.waitingOn(direction) {
+		if result.Verdict == verdictError {
+			op.reverifyShadow(result)
+			continue
+		}
+		if direction == directionOutgoing {
+			tx, err := op.evmVerifier.GetOutgoingTx(op.ctx, new(big.Int).SetUint64(result.Id))
+			if err != nil {
+				op.logger.Error("get outgoing tx error", "invoice_id", result.Id, "direction", direction, "err", err)
+				continue
+			}
+			op.settleOutgoing(&result, tx)
+		} else {
+			invoice, err := op.evmVerifier.GetIncomingInvoice(op.ctx, result.Id)
+			if err != nil {
+				op.logger.Error("get incoming invoice error", "invoice_id", result.Id, "direction", direction, "err", err)
+				continue
+			}
+			op.settleIncoming(&result, invoice)
+		}
+		if result.Outcome != outcomePending {
+			op.recordShadow(result)
+		}
+	}
+}
+
+// reverifyShadow verifies again the invoice or tx of result, whose
+// verification failed, and records it when the chain settled it.
+func (op *Operator) reverifyShadow(failed ReplayResult) {
+	var (
+		result ReplayResult
+		err    error
+	)
+	if failed.Direction == directionOutgoing {
+		result, err = op.replayOutgoing(failed.Id)
+	} else {
+		result, err = op.replayIncoming(failed.Id)
+	}
+	if err != nil {
+		op.logger.Error("shadow verify error", "invoice_id", failed.Id, "direction", failed.Direction, "err", err)
+		return
+	}
+	op.recordVerdict(result.InvoiceRecord)
+	if result.Outcome == outcomePending {
+		op.shadow.wait(result)
+		return
+	}
+	op.recordShadow(result)
+}
+
+// shadowCursor returns the next id to verify in direction. It starts where
+// the gateway cursor of our address stands for incoming invoices, and at
+// the latest tx for outgoing txs, as the vote loops do.
+func (op *Operator) shadowCursor(direction string) (uint64, error) {
+	if next, ok := op.shadow.cursor(direction); ok {
+		return next, nil
+	}
+	var next uint64
+	if direction == directionOutgoing {
+		count, err := op.shadowCount(direction)
+		if err != nil {
+			return 0, err
+		}
+		next = count
+	} else {
+		nextId, err := op.evmVerifier.GetNextIdVerifyIncomingInvoice(op.ctx, op.evmVerifier.GetAddress())
+		if err != nil {
+			return 0, err
+		}
+		next = nextId.Uint64()
+	}
+	if next == 0 {
+		next = 1
+	}
+	op.shadow.advance(direction, next)
+	return next, nil
+}
+
+func (op *Operator) shadowCount(direction string) (uint64, error) {
+	var (
+		count *big.Int
+		err   error
+	)
+	if direction == directionOutgoing {
+		count, err = op.evmVerifier.GetOutgoingTxCount(op.ctx)
+	} else {
+		count, err = op.evmVerifier.GetIncomingInvoiceCount(op.ctx)
+	}
+	if err != nil || count == nil {
+		return 0, err
+	}
+	return count.Uint64(), nil
+}
+
+// recordShadow logs the shadow verdict on a settled invoice, and records
+// the disagreement with the chain if any. A validator disagrees when it
+// confirmed what we would reject; one that did not confirm may simply not
+// have voted, so only the outcome is held against a valid verdict.
+func (op *Operator) recordShadow(result ReplayResult) {
+	var validators []string
+	if result.Verdict != verdictValid {
+		for address, confirmed := range result.Confirmations {
+			if confirmed {
+				validators = append(validators, address)
+			}
+		}
+		sort.Strings(validators)
+	}
+
+	logger := op.invoiceLogger(result.Direction, result.Id, result.CorrelationId)
+	var disagreement *ShadowDisagreement
+	if result.Diff != "" || len(validators) > 0 {
+		disagreement = &ShadowDisagreement{ReplayResult: result, Validators: validators}
+		metrics.ShadowDisagreements.WithLabelValues(result.Direction).Inc()
+		logger.Warn("shadow verdict disagrees with chain",
+			"verdict", result.Verdict, "outcome", result.Outcome, "diff", result.Diff, "validators", validators)
+	} else {
+		logger.Info("shadow verdict", "verdict", result.Verdict, "outcome", result.Outcome)
+	}
+	op.shadow.record(result, disagreement)
+}
@@ -0,0 +1,190 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/aura-nw/lotus-core/clients/evm/contracts"
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+	"github.com/aura-nw/lotus-operator/internal/operator/evm/evmtest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessShadowIncoming(t *testing.T) {
+	invoices := []contracts.IGatewayIncomingInvoiceResponse{
+		incomingInvoice(1, evm.Minted, true, false),
+		incomingInvoice(2, evm.Minted, true, false),
+		incomingInvoice(3, evm.Pending, false, false),
+		incomingInvoice(4, evm.Minted, true, false),
+	}
+	invoices[1].Utxo = "bad"
+
+	evmVerifier := &evmtest.MockVerifier{}
+	gatewayWith(evmVerifier, 1, invoices...)
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(utxo string, amount uint64, recipient string) (bool, int64, error) {
+			return utxo != "bad", 6, nil
+		},
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	op.shadow = newShadowState()
+
+	// Invoice 3 waits for votes, invoice 4 is checked all the same
+	op.processShadow(directionIncoming)
+	report, ok := op.ShadowReport()
+	require.True(t, ok)
+	require.Equal(t, uint64(5), report.NextIncoming)
+	require.Equal(t, 3, report.Checked[directionIncoming])
+	require.Equal(t, 1, report.Waiting[directionIncoming])
+	require.Len(t, report.Disagreements, 1)
+	require.Equal(t, uint64(2), report.Disagreements[0].Id)
+	require.Equal(t, verdictInvalid, report.Disagreements[0].Verdict)
+	require.Equal(t, []string{other.Hex()}, report.Disagreements[0].Validators)
+
+	// Would-be votes are recorded like votes, without a tx
+	records := op.IncomingInvoices()
+	require.Len(t, records, 4)
+	require.Empty(t, records[0].VoteTxHash)
+
+	// Nothing settled, nothing verified again
+	op.processShadow(directionIncoming)
+	report, _ = op.ShadowReport()
+	require.Equal(t, 3, report.Checked[directionIncoming])
+	require.Equal(t, 4, btcVerifier.Calls("VerifyBtcDeposit"))
+
+	// Validators refund invoice 3, which we found valid
+	invoices[2].Status = uint8(evm.Refunding)
+	op.processShadow(directionIncoming)
+	report, _ = op.ShadowReport()
+	require.Equal(t, uint64(5), report.NextIncoming)
+	require.Equal(t, 4, report.Checked[directionIncoming])
+	require.Zero(t, report.Waiting[directionIncoming])
+	require.Len(t, report.Disagreements, 2)
+	require.Equal(t, uint64(3), report.Disagreements[0].Id)
+	require.Equal(t, "valid now, rejected on chain", report.Disagreements[0].Diff)
+	require.Empty(t, report.Disagreements[0].Validators)
+	require.Equal(t, 4, btcVerifier.Calls("VerifyBtcDeposit"))
+
+	require.Zero(t, evmVerifier.Calls("VerifyIncomingInvoice"))
+}
+
+func TestProcessShadowRetriesFailedVerification(t *testing.T) {
+	invoices := []contracts.IGatewayIncomingInvoiceResponse{
+		incomingInvoice(1, evm.Minted, true, false),
+		incomingInvoice(2, evm.Minted, true, false),
+	}
+	invoices[1].Utxo = "unreachable"
+
+	evmVerifier := &evmtest.MockVerifier{}
+	gatewayWith(evmVerifier, 1, invoices...)
+	confirmed := false
+	btcVerifier := &bitcointest.MockVerifier{
+		VerifyBtcDepositFn: func(utxo string, amount uint64, recipient string) (bool, int64, error) {
+			if utxo == "unreachable" {
+				return false, 0, errRPC
+			}
+			if !confirmed {
+				return false, 1, bitcoin.ErrNotConfirmed
+			}
+			return true, 6, nil
+		},
+	}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	op.shadow = newShadowState()
+
+	// Both invoices are minted, yet neither failure is held against the chain
+	op.processShadow(directionIncoming)
+	report, _ := op.ShadowReport()
+	require.Equal(t, uint64(3), report.NextIncoming)
+	require.Zero(t, report.Checked[directionIncoming])
+	require.Equal(t, 2, report.Waiting[directionIncoming])
+	require.Empty(t, report.Disagreements)
+
+	// The deposit confirms, invoice 2 still fails once verified again
+	confirmed = true
+	op.processShadow(directionIncoming)
+	report, _ = op.ShadowReport()
+	require.Equal(t, 2, report.Checked[directionIncoming])
+	require.Zero(t, report.Waiting[directionIncoming])
+	require.Len(t, report.Disagreements, 1)
+	require.Equal(t, uint64(2), report.Disagreements[0].Id)
+	require.Equal(t, verdictError, report.Disagreements[0].Verdict)
+	require.Equal(t, 4, btcVerifier.Calls("VerifyBtcDeposit"))
+
+	records := op.IncomingInvoices()
+	require.Len(t, records, 2)
+	require.Equal(t, uint64(1), records[1].Id)
+	require.Equal(t, verdictValid, records[1].Verdict)
+}
+
+func TestProcessShadowOutgoing(t *testing.T) {
+	tx := contracts.IGatewayOutgoingTxInfo{
+		TxId:       big.NewInt(1),
+		InvoiceIds: []*big.Int{big.NewInt(1)},
+		TxContent:  withdrawalTx(t, 400),
+		Validators: []common.Address{other, self},
+		Signatures: []string{"cd", ""},
+		Status:     uint8(evm.Paid),
+	}
+	evmVerifier := &evmtest.MockVerifier{
+		GetOutgoingTxCountFn: func() (*big.Int, error) { return big.NewInt(1), nil },
+		GetOutgoingTxFn:      func(*big.Int) (contracts.IGatewayOutgoingTxInfo, error) { return tx, nil },
+		GetOutgoingInvoiceFn: func(uint64) (contracts.IGatewayOutgoingInvoiceResponse, error) {
+			return contracts.IGatewayOutgoingInvoiceResponse{
+				InvoiceId: big.NewInt(1),
+				Amount:    big.NewInt(500),
+				Recipient: withdrawalAddr,
+				Status:    uint8(evm.Paid),
+			}, nil
+		},
+	}
+	btcVerifier := &bitcointest.MockVerifier{ConvertToAddressFn: regtestAddress}
+	op := newScenarioOperator(t, evmVerifier, btcVerifier)
+	op.shadow = newShadowState()
+
+	// The tx pays less than its invoice, yet it was signed and paid
+	op.processShadow(directionOutgoing)
+	report, _ := op.ShadowReport()
+	require.Equal(t, uint64(2), report.NextOutgoing)
+	require.Len(t, report.Disagreements, 1)
+	require.Equal(t, verdictInvalid, report.Disagreements[0].Verdict)
+	require.Equal(t, "invalid now, accepted on chain", report.Disagreements[0].Diff)
+	require.Equal(t, []string{other.Hex()}, report.Disagreements[0].Validators)
+	require.Zero(t, evmVerifier.Calls("VerifyOutgoingTx"))
+	require.Zero(t, btcVerifier.Calls("Sign"))
+}
+
+func TestServerShadow(t *testing.T) {
+	op := newScenarioOperator(t, &evmtest.MockVerifier{}, &bitcointest.MockVerifier{})
+	rec := serve(t, op.server, "/shadow")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	op.shadow = newShadowState()
+	op.shadow.advance(directionIncoming, 5)
+	rec = serve(t, op.server, "/shadow")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report ShadowReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Equal(t, uint64(5), report.NextIncoming)
+}
+
+func TestShadowMode(t *testing.T) {
+	cfg := &config.Config{
+		Mode:   config.ModeShadow,
+		Server: config.ServerInfo{HttpPort: "0"},
+		Evm:    config.EvmInfo{QueryInterval: 1},
+	}
+	op, err := NewOperatorWithVerifiers(context.Background(), cfg, slog.Default(), &evmtest.MockVerifier{}, &bitcointest.MockVerifier{})
+	require.NoError(t, err)
+	defer op.cancel()
+	require.NotNil(t, op.shadow)
+	require.Equal(t, config.ModeShadow, op.Status().Mode)
+}
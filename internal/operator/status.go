@@ -0,0 +1,184 @@
+package operator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/internal/operator/evm"
+)
+
+const (
+	maxRecentInvoices = 100
+
+	incomingLoopName = "incoming"
+	outgoingLoopName = "outgoing"
+
+	directionIncoming = "incoming"
+	directionOutgoing = "outgoing"
+
+	verdictValid   = "valid"
+	verdictInvalid = "invalid"
+	verdictError   = "error"
+
+	reasonDepositVerified  = "deposit_verified"
+	reasonDepositInvalid   = "deposit_invalid"
+	reasonDepositLookup    = "deposit_lookup_failed"
+	reasonInvoiceLookup    = "invoice_lookup_failed"
+	reasonOutputsVerified  = "outputs_verified"
+	reasonOutputsMismatch  = "outputs_mismatch"
+	reasonVerifyAndSignBtc = "verify_and_sign_failed"
+)
+
+// Status is a snapshot of what the operator is doing, served on /status.
+type Status struct {
+	Mode            string               `json:"mode"`
+	EvmAddress      string               `json:"evm_address"`
+	BtcPubKey       string               `json:"btc_pubkey"`
+	MultisigAddress string               `json:"multisig_address"`
+	EvmHeight       uint64               `json:"evm_height"`
+	BtcHeight       int64                `json:"btc_height"`
+	Paused          bool                 `json:"paused"`
+	Balance         evm.BalanceInfo      `json:"balance"`
+	EvmEndpoints    []evm.EndpointHealth `json:"evm_endpoints,omitempty"`
+	Loops           map[string]time.Time `json:"loops"`
+	Components      []ComponentHealth    `json:"components"`
+	Config          ConfigStatus         `json:"config"`
+	Errors          map[string]string    `json:"errors,omitempty"`
+}
+
+// InvoiceRecord is the outcome of the operator evaluating one invoice.
+type InvoiceRecord struct {
+	Id        uint64 `json:"id"`
+	Direction string `json:"direction"`
+	// CorrelationId matches the record with the log lines of its evaluation
+	CorrelationId string   `json:"correlation_id,omitempty"`
+	Utxo          string   `json:"utxo,omitempty"`
+	InvoiceIds    []uint64 `json:"invoice_ids,omitempty"`
+	Amount        string   `json:"amount,omitempty"`
+	Recipient     string   `json:"recipient,omitempty"`
+	// DepositConfirmations is how many confirmations the deposit tx had
+	// when verified
+	DepositConfirmations int64     `json:"deposit_confirmations,omitempty"`
+	Verdict              string    `json:"verdict"`
+	Reason               string    `json:"reason"`
+	Error                string    `json:"error,omitempty"`
+	VoteTxHash           string    `json:"vote_tx_hash,omitempty"`
+	Time                 time.Time `json:"time"`
+}
+
+// statusTracker keeps loop run times, the most recent invoice records and
+// the votes sent.
+type statusTracker struct {
+	mu       sync.RWMutex
+	loops    map[string]time.Time
+	incoming []InvoiceRecord
+	outgoing []InvoiceRecord
+	// votes holds, per direction, the ids voted on until the gateway shows
+	// the vote, see voted
+	votes map[string]map[uint64]bool
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		loops: make(map[string]time.Time),
+		votes: map[string]map[uint64]bool{
+			directionIncoming: make(map[uint64]bool),
+			directionOutgoing: make(map[uint64]bool),
+		},
+	}
+}
+
+func (t *statusTracker) markLoop(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loops[name] = time.Now()
+}
+
+func (t *statusTracker) loopTimes() map[string]time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	loops := make(map[string]time.Time, len(t.loops))
+	for name, last := range t.loops {
+		loops[name] = last
+	}
+	return loops
+}
+
+// record stores r and reports whether its verdict is new for the id or
+// differs from the last one recorded.
+func (t *statusTracker) record(r InvoiceRecord) bool {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var changed bool
+	switch r.Direction {
+	case directionIncoming:
+		t.incoming, changed = appendRecent(t.incoming, r)
+	case directionOutgoing:
+		t.outgoing, changed = appendRecent(t.outgoing, r)
+	}
+	return changed
+}
+
+// recent returns records of the given direction, newest first.
+func (t *statusTracker) recent(direction string) []InvoiceRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	src := t.incoming
+	if direction == directionOutgoing {
+		src = t.outgoing
+	}
+	records := make([]InvoiceRecord, 0, len(src))
+	for i := len(src) - 1; i >= 0; i-- {
+		records = append(records, src[i])
+	}
+	return records
+}
+
+// markVoted records that a vote on the invoice or outgoing tx id of
+// direction was sent without error.
+func (t *statusTracker) markVoted(direction string, id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.votes[direction][id] = true
+}
+
+// voted reports whether a vote on the invoice or outgoing tx id of direction
+// was sent and the gateway does not show it yet. Reads are pinned to
+// confirmed blocks, so the gateway shows the vote only after
+// min-confirmations.
+func (t *statusTracker) voted(direction string, id uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.votes[direction][id]
+}
+
+// clearVote forgets the vote on id once the gateway shows it, or the invoice
+// no longer waits for votes.
+func (t *statusTracker) clearVote(direction string, id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.votes[direction], id)
+}
+
+// appendRecent appends r to records, replacing the record of an earlier
+// evaluation of the same id so that retries do not push out other invoices.
+// It reports whether the verdict or reason of r differs from that record.
+func appendRecent(records []InvoiceRecord, r InvoiceRecord) ([]InvoiceRecord, bool) {
+	changed := true
+	for i := range records {
+		if records[i].Id == r.Id {
+			changed = records[i].Verdict != r.Verdict || records[i].Reason != r.Reason
+			records = append(records[:i], records[i+1:]...)
+			break
+		}
+	}
+	records = append(records, r)
+	if len(records) > maxRecentInvoices {
+		records = records[len(records)-maxRecentInvoices:]
+	}
+	return records, changed
+}
@@ -0,0 +1,41 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusVoted(t *testing.T) {
+	tracker := newStatusTracker()
+	tracker.markVoted(directionIncoming, 1)
+	require.True(t, tracker.voted(directionIncoming, 1))
+	require.False(t, tracker.voted(directionOutgoing, 1))
+	require.False(t, tracker.voted(directionIncoming, 2))
+
+	// Records of later evaluations do not push the vote out
+	for i := 0; i < 2*maxRecentInvoices; i++ {
+		tracker.record(InvoiceRecord{Id: 2, Direction: directionIncoming, Verdict: verdictError, Error: "deposit not confirmed"})
+	}
+	require.True(t, tracker.voted(directionIncoming, 1))
+
+	tracker.clearVote(directionIncoming, 1)
+	require.False(t, tracker.voted(directionIncoming, 1))
+}
+
+func TestStatusRecordReplacesRetries(t *testing.T) {
+	tracker := newStatusTracker()
+	require.True(t, tracker.record(InvoiceRecord{Id: 1, Direction: directionIncoming, Verdict: verdictValid}))
+	require.True(t, tracker.record(InvoiceRecord{Id: 2, Direction: directionIncoming, Verdict: verdictError, Error: "deposit not confirmed"}))
+	for i := 0; i < 2*maxRecentInvoices; i++ {
+		require.False(t, tracker.record(InvoiceRecord{Id: 2, Direction: directionIncoming, Verdict: verdictError, Error: "deposit not confirmed"}))
+	}
+	require.True(t, tracker.record(InvoiceRecord{Id: 2, Direction: directionIncoming, Verdict: verdictValid}))
+
+	records := tracker.recent(directionIncoming)
+	require.Len(t, records, 2)
+	require.Equal(t, uint64(2), records[0].Id)
+	require.Equal(t, verdictValid, records[0].Verdict)
+	require.Equal(t, uint64(1), records[1].Id)
+	require.Empty(t, tracker.recent(directionOutgoing))
+}
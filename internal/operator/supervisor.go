@@ -0,0 +1,140 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+
+	componentRunning    = "running"
+	componentRestarting = "restarting"
+	componentStopped    = "stopped"
+)
+
+// ComponentHealth is the supervisor view of one component, served on /status.
+type ComponentHealth struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// supervisor runs components in goroutines, recovers their panics and
+// restarts them with exponential backoff until its context is done.
+type supervisor struct {
+	ctx context.Context
+	// logger has no component attribute, each line names the supervised
+	// component instead
+	logger *slog.Logger
+	wg     sync.WaitGroup
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu         sync.RWMutex
+	components map[string]*ComponentHealth
+}
+
+func newSupervisor(ctx context.Context, logger *slog.Logger) *supervisor {
+	return &supervisor{
+		ctx:        ctx,
+		logger:     logger,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		components: make(map[string]*ComponentHealth),
+	}
+}
+
+// Go runs fn as the component name. fn should return when ctx is done; any
+// other return or panic restarts it after a backoff.
+func (s *supervisor) Go(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	s.components[name] = &ComponentHealth{Name: name, State: componentRunning, StartedAt: time.Now()}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(name, fn)
+	}()
+}
+
+func (s *supervisor) supervise(name string, fn func(ctx context.Context) error) {
+	backoff := s.minBackoff
+	for {
+		started := time.Now()
+		err := s.runOnce(name, fn)
+		if s.ctx.Err() != nil {
+			s.update(name, func(c *ComponentHealth) { c.State = componentStopped })
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("component exited unexpectedly")
+		}
+
+		// A component that ran for a while is considered recovered
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		s.logger.Error("component failed, restarting", "component", name, "err", err, "backoff", backoff)
+		s.update(name, func(c *ComponentHealth) {
+			c.State = componentRestarting
+			c.Restarts++
+			c.LastError = err.Error()
+		})
+
+		select {
+		case <-s.ctx.Done():
+			s.update(name, func(c *ComponentHealth) { c.State = componentStopped })
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+		s.update(name, func(c *ComponentHealth) {
+			c.State = componentRunning
+			c.StartedAt = time.Now()
+		})
+	}
+}
+
+func (s *supervisor) runOnce(name string, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("component panicked", "component", name, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(s.ctx)
+}
+
+func (s *supervisor) update(name string, fn func(c *ComponentHealth)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.components[name])
+}
+
+// Components returns the health of every component sorted by name.
+func (s *supervisor) Components() []ComponentHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	components := make([]ComponentHealth, 0, len(s.components))
+	for _, c := range s.components {
+		components = append(components, *c)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+	return components
+}
+
+// Wait blocks until every component has stopped.
+func (s *supervisor) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,70 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorRestartsOnPanicAndError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newSupervisor(ctx, slog.Default())
+	s.minBackoff = time.Millisecond
+	s.maxBackoff = 4 * time.Millisecond
+
+	var runs atomic.Int32
+	s.Go("flaky", func(ctx context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			panic("malformed utxo")
+		case 2:
+			return errors.New("listen tcp: address already in use")
+		}
+		<-ctx.Done()
+		return nil
+	})
+
+	require.Eventually(t, func() bool {
+		c := s.Components()[0]
+		return runs.Load() == 3 && c.State == componentRunning
+	}, time.Second, time.Millisecond)
+
+	c := s.Components()[0]
+	require.Equal(t, 2, c.Restarts)
+	require.Contains(t, c.LastError, "address already in use")
+
+	cancel()
+	s.Wait()
+	require.Equal(t, componentStopped, s.Components()[0].State)
+}
+
+func TestSupervisorLogsComponent(t *testing.T) {
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newSupervisor(ctx, slog.New(slog.NewJSONHandler(&buf, nil)))
+	s.minBackoff = time.Hour
+
+	failed := make(chan struct{})
+	s.Go("balance", func(ctx context.Context) error {
+		close(failed)
+		return errors.New("rpc down")
+	})
+	<-failed
+	require.Eventually(t, func() bool {
+		return s.Components()[0].State == componentRestarting
+	}, time.Second, time.Millisecond)
+	cancel()
+	s.Wait()
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &line))
+	require.Equal(t, "component failed, restarting", line["msg"])
+	require.Equal(t, "balance", line["component"])
+}
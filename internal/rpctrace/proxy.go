@@ -0,0 +1,57 @@
+package rpctrace
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// Proxy serves a transport on a local address, for clients such as
+// rpcclient that cannot be given an http.Client. Requests are sent to the
+// target host through the transport.
+type Proxy struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewProxy starts a proxy on a random local port forwarding to target, a
+// base url such as https://node:8332.
+func NewProxy(target string, transport http.RoundTripper) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(u)
+			r.Out.Host = u.Host
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	p := &Proxy{listener: listener, server: &http.Server{Handler: proxy}}
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			listener.Close()
+		}
+	}()
+	return p, nil
+}
+
+// Addr returns the host:port the proxy listens on.
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Close stops the proxy.
+func (p *Proxy) Close() error {
+	return p.server.Close()
+}
@@ -0,0 +1,77 @@
+package rpctrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Recorder is an http.RoundTripper sending requests with a base transport
+// and appending each exchange to a trace file.
+type Recorder struct {
+	base http.RoundTripper
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewRecorder appends the exchanges of base to the trace at path, created if
+// missing. A nil base uses http.DefaultTransport.
+func NewRecorder(path string, base http.RoundTripper) (*Recorder, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{base: base, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	ex := newExchange(req, body)
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		ex.Error = err.Error()
+		return nil, r.write(ex, err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		ex.Error = err.Error()
+		return nil, r.write(ex, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	ex.Status = resp.StatusCode
+	ex.ContentType = resp.Header.Get("Content-Type")
+	ex.Response = string(respBody)
+	return resp, r.write(ex, nil)
+}
+
+// write appends ex to the trace and returns err, or the write error.
+func (r *Recorder) write(ex Exchange, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if werr := r.enc.Encode(ex); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// Close closes the trace file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,101 @@
+package rpctrace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecorded is returned for requests the trace has no response for.
+var ErrNotRecorded = errors.New("rpctrace: request not recorded")
+
+// Replayer is an http.RoundTripper serving the responses of a trace. Equal
+// requests get their recorded responses in order, then the last one again,
+// so polled reads such as the block height keep answering.
+type Replayer struct {
+	mu      sync.Mutex
+	pending map[string][]Exchange
+	last    map[string]Exchange
+}
+
+// NewReplayer loads the trace at path.
+func NewReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := &Replayer{
+		pending: make(map[string][]Exchange),
+		last:    make(map[string]Exchange),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		key := ex.key()
+		r.pending[key] = append(r.pending[key], ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	ex, ok := r.next(newExchange(req, body))
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL.Host)
+	}
+	if ex.Error != "" {
+		return nil, errors.New(ex.Error)
+	}
+
+	response := withIds(ex.Response, body)
+	header := make(http.Header)
+	if ex.ContentType != "" {
+		header.Set("Content-Type", ex.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		StatusCode:    ex.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Replayer) next(req Exchange) (Exchange, bool) {
+	key := req.key()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if queue := r.pending[key]; len(queue) > 0 {
+		r.pending[key] = queue[1:]
+		r.last[key] = queue[0]
+		return queue[0], true
+	}
+	ex, ok := r.last[key]
+	return ex, ok
+}
@@ -0,0 +1,107 @@
+// Package rpctrace records the HTTP exchanges of the chain clients to a file
+// and serves them back, so an incident captured in production can be
+// replayed deterministically against the operator logic.
+//
+// A trace is a file of JSON lines, one Exchange per line. JSON-RPC requests
+// are matched on their body without the id, so a replayed client may number
+// its requests differently from the recorded one.
+package rpctrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Exchange is one recorded request and its response.
+type Exchange struct {
+	Host   string `json:"host"`
+	Method string `json:"method"`
+	// Path is only kept for requests other than POST, such as Esplora reads:
+	// JSON-RPC providers put api keys in the path.
+	Path        string `json:"path,omitempty"`
+	Request     string `json:"request,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Response    string `json:"response,omitempty"`
+	// Error is the transport error the request failed with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// key identifies the requests served with the same recorded responses.
+func (e *Exchange) key() string {
+	return e.Method + " " + e.Host + e.Path + "\n" + canonical([]byte(e.Request))
+}
+
+func newExchange(req *http.Request, body []byte) Exchange {
+	ex := Exchange{
+		Host:    req.URL.Host,
+		Method:  req.Method,
+		Request: string(body),
+	}
+	if req.Method != http.MethodPost {
+		ex.Path = req.URL.RequestURI()
+	}
+	return ex
+}
+
+// readBody reads the body of req and puts it back for the next reader.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// canonical returns body with the ids of its JSON-RPC calls removed and its
+// keys sorted, or body itself when it is not JSON.
+func canonical(body []byte) string {
+	var call map[string]json.RawMessage
+	if err := json.Unmarshal(body, &call); err == nil {
+		delete(call, "id")
+		out, _ := json.Marshal(call)
+		return string(out)
+	}
+	var batch []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &batch); err == nil {
+		for _, call := range batch {
+			delete(call, "id")
+		}
+		out, _ := json.Marshal(batch)
+		return string(out)
+	}
+	return string(body)
+}
+
+// withIds returns the recorded response with the ids of request, so the
+// client matches it to the call it sent.
+func withIds(response string, request []byte) string {
+	var call, answer map[string]json.RawMessage
+	if json.Unmarshal(request, &call) == nil && json.Unmarshal([]byte(response), &answer) == nil {
+		if id, ok := call["id"]; ok {
+			answer["id"] = id
+			out, _ := json.Marshal(answer)
+			return string(out)
+		}
+		return response
+	}
+	var calls, answers []map[string]json.RawMessage
+	if json.Unmarshal(request, &calls) == nil && json.Unmarshal([]byte(response), &answers) == nil &&
+		len(calls) == len(answers) {
+		for i := range answers {
+			if id, ok := calls[i]["id"]; ok {
+				answers[i]["id"] = id
+			}
+		}
+		out, _ := json.Marshal(answers)
+		return string(out)
+	}
+	return response
+}
@@ -0,0 +1,154 @@
+package rpctrace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin"
+	"github.com/aura-nw/lotus-operator/internal/operator/bitcoin/bitcointest"
+	"github.com/aura-nw/lotus-operator/internal/rpctrace"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// counter is a JSON-RPC server answering each call with the number of calls
+// it received so far.
+func counter(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id json.RawMessage `json:"id"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.Id, "result": calls.Add(1)})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func call(t *testing.T, client *http.Client, url string, id int) string {
+	body := `{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"eth_blockNumber","params":[]}`
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server, calls := counter(t)
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+
+	recorder, err := rpctrace.NewRecorder(path, nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: recorder}
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":1}`, call(t, client, server.URL, 1))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":2}`, call(t, client, server.URL, 2))
+	require.NoError(t, recorder.Close())
+
+	replayer, err := rpctrace.NewReplayer(path)
+	require.NoError(t, err)
+	client = &http.Client{Transport: replayer}
+	// Responses come back in order, with the ids of the replayed requests,
+	// and the last one repeats
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":5,"result":1}`, call(t, client, server.URL, 5))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":6,"result":2}`, call(t, client, server.URL, 6))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":7,"result":2}`, call(t, client, server.URL, 7))
+	require.Equal(t, int64(2), calls.Load())
+
+	_, err = client.Post(server.URL, "application/json", strings.NewReader(`{"method":"eth_chainId"}`))
+	require.ErrorIs(t, err, rpctrace.ErrNotRecorded)
+}
+
+func TestReplayKeepsTransportErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recorder, err := rpctrace.NewRecorder(path, nil)
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: recorder}).Get("http://127.0.0.1:1/blocks/tip/height")
+	require.Error(t, err)
+	require.NoError(t, recorder.Close())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var ex rpctrace.Exchange
+	require.NoError(t, json.Unmarshal(raw, &ex))
+	require.Equal(t, "/blocks/tip/height", ex.Path)
+	require.NotEmpty(t, ex.Error)
+
+	replayer, err := rpctrace.NewReplayer(path)
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: replayer}).Get("http://127.0.0.1:1/blocks/tip/height")
+	require.ErrorContains(t, err, ex.Error)
+	require.NotErrorIs(t, err, rpctrace.ErrNotRecorded)
+}
+
+func TestReplayBitcoinVerifier(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	wif, err := btcutil.NewWIF(key, &chaincfg.RegressionNetParams, true)
+	require.NoError(t, err)
+	multisig, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	info := config.BitcoinInfo{
+		Network:          config.NetworkRegtest,
+		MultisigAddress:  multisig.EncodeAddress(),
+		RedeemScript:     "51",
+		PrivateKey:       wif.String(),
+		MinConfirmations: 1,
+	}
+
+	bitcoind := bitcointest.NewBitcoind(&chaincfg.RegressionNetParams)
+	bitcoind.Configure(&info)
+	pkScript, err := txscript.PayToAddrScript(multisig)
+	require.NoError(t, err)
+	deposit := wire.NewMsgTx(wire.TxVersion)
+	deposit.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	deposit.AddTxOut(wire.NewTxOut(1000, pkScript))
+	bitcoind.AddTransaction(deposit, 1)
+	bitcoind.Mine(1)
+	recipient := "0xC32B94C38bbbfe65eCe90daF3493c7603dA2c19A"
+	utxo := bitcoin.UtxoDef{TxHash: deposit.TxHash().String(), Amount: 1000, Receiver: recipient}
+
+	verify := func(transport http.RoundTripper) bool {
+		verifier, err := bitcoin.NewVerifierWithTransport(slog.Default(), info, transport)
+		require.NoError(t, err)
+		valid, _, err := verifier.VerifyBtcDeposit(context.Background(), utxo.String(), 1000, recipient)
+		require.NoError(t, err)
+		return valid
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recorder, err := rpctrace.NewRecorder(path, nil)
+	require.NoError(t, err)
+	require.True(t, verify(recorder))
+	require.NoError(t, recorder.Close())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(raw, []byte("getrawtransaction")))
+	require.False(t, bytes.Contains(raw, []byte(bitcointest.Pass)), "credentials are not recorded")
+
+	// The node is gone, the trace answers instead
+	bitcoind.Close()
+	replayer, err := rpctrace.NewReplayer(path)
+	require.NoError(t, err)
+	require.True(t, verify(replayer))
+}
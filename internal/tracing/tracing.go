@@ -0,0 +1,117 @@
+// Package tracing exports the OpenTelemetry spans of invoice processing.
+//
+// Spans are started from the context of their caller, so the contract reads,
+// bitcoin lookups, signature and vote of an invoice nest under the span of
+// its evaluation. Until Setup installs a provider every span is a no-op.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName     = "lotus-operator"
+	instrumentation = "github.com/aura-nw/lotus-operator"
+)
+
+// Start starts the span name as a child of the span in ctx and returns a
+// context holding it. Without a span in ctx the returned span is a no-op:
+// only invoice evaluations are traced, not the polling around them.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartRoot starts the span name of a new trace, begun at start.
+func StartRoot(ctx context.Context, name string, start time.Time, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithNewRoot(), trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+}
+
+// Record records the span name, begun at start and ended now, as a child
+// of the span in ctx.
+func Record(ctx context.Context, name string, start time.Time, attrs ...attribute.KeyValue) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	_, span := otel.Tracer(instrumentation).Start(ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	span.End()
+}
+
+// End ends span, marking it failed when err points to an error.
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// Setup installs the global tracer provider exporting spans as configured
+// in info, version being the one of the operator. It returns a function
+// flushing and stopping the exporter, a no-op when tracing is disabled.
+func Setup(ctx context.Context, info config.TracingInfo, version string) (func(context.Context) error, error) {
+	if info.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := newExporter(ctx, info, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	provider := NewProvider(exporter, info.SampleRatio, version)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider batching spans to exporter, sampling
+// ratio of the invoices, or all of them when ratio is zero.
+func NewProvider(exporter sdktrace.SpanExporter, ratio float64, version string) *sdktrace.TracerProvider {
+	sampler := sdktrace.AlwaysSample()
+	if ratio > 0 {
+		sampler = sdktrace.TraceIDRatioBased(ratio)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version),
+		)),
+	)
+}
+
+func newExporter(ctx context.Context, info config.TracingInfo, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch info.Exporter {
+	case config.TracingOTLP:
+		var opts []otlptracehttp.Option
+		if info.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(info.Endpoint))
+		}
+		if info.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case config.TracingStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", info.Exporter)
+	}
+}
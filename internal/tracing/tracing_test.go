@@ -0,0 +1,64 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aura-nw/lotus-operator/config"
+	"github.com/aura-nw/lotus-operator/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestStart(t *testing.T) {
+	recorder := record(t)
+
+	// Without a parent nothing is traced
+	ctx, span := tracing.Start(context.Background(), "poll")
+	require.False(t, span.IsRecording())
+	tracing.Record(ctx, "discover", time.Now())
+	span.End()
+	require.Empty(t, recorder.Ended())
+
+	discovered := time.Now().Add(-time.Second)
+	ctx, root := tracing.StartRoot(context.Background(), "incoming invoice", discovered)
+	tracing.Record(ctx, "discover", discovered)
+	_, child := tracing.Start(ctx, "bitcoin.VerifyBtcDeposit")
+	err := errors.New("rpc down")
+	tracing.End(child, &err)
+	var ok error
+	tracing.End(root, &ok)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	discover, failed, invoice := spans[0], spans[1], spans[2]
+	require.Equal(t, "incoming invoice", invoice.Name())
+	require.Equal(t, discovered, invoice.StartTime())
+	require.Equal(t, discovered, discover.StartTime())
+	require.Equal(t, codes.Unset, invoice.Status().Code)
+	for _, span := range []sdktrace.ReadOnlySpan{discover, failed} {
+		require.Equal(t, invoice.SpanContext().SpanID(), span.Parent().SpanID())
+		require.Equal(t, invoice.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+	require.Equal(t, codes.Error, failed.Status().Code)
+	require.Equal(t, "rpc down", failed.Status().Description)
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), config.TracingInfo{}, "test")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+}